@@ -0,0 +1,194 @@
+package raster
+
+import (
+	"math"
+	"slices"
+)
+
+// ------------ BVH -------------
+
+// bounding volume hierarchy over a mesh's triangles, in the mesh's own space.
+// moving a model doesn't touch it, rays get moved into model space instead,
+// so it only needs rebuilding when the mesh itself changes (see Mesh.Invalidate).
+
+const bvhLeafSize = 4
+
+type bvhNode struct {
+	box         AABB
+	left, right int // child nodes, 0 for leaves (the root can't be a child)
+	start, end  int // range in bvh.triangles, for leaves
+}
+
+type bvh struct {
+	nodes     []bvhNode
+	triangles []int // triangle indices, grouped by leaf
+}
+
+func (a AABB) grow(p Float3) AABB {
+	return AABB{
+		Float3{min(a.Min.X, p.X), min(a.Min.Y, p.Y), min(a.Min.Z, p.Z)},
+		Float3{max(a.Max.X, p.X), max(a.Max.Y, p.Y), max(a.Max.Z, p.Z)},
+	}
+}
+
+func emptyAABB() AABB {
+	inf := math.Inf(1)
+	return AABB{Float3{inf, inf, inf}, Float3{-inf, -inf, -inf}}
+}
+
+func (m *Mesh) triangle(t int) (a, b, c Float3) {
+	return m.Positions[m.Indices[t*3]], m.Positions[m.Indices[t*3+1]], m.Positions[m.Indices[t*3+2]]
+}
+
+func buildBVH(m *Mesh) *bvh {
+	tree := &bvh{triangles: make([]int, m.NumTriangles())}
+	centroids := make([]Float3, m.NumTriangles())
+	for t := range tree.triangles {
+		tree.triangles[t] = t
+		a, b, c := m.triangle(t)
+		centroids[t] = a.add(b).add(c).mulscal(1.0 / 3)
+	}
+
+	var build func(start, end int) int
+	build = func(start, end int) int {
+		node := bvhNode{box: emptyAABB(), start: start, end: end}
+		centerBox := emptyAABB()
+		for _, t := range tree.triangles[start:end] {
+			a, b, c := m.triangle(t)
+			node.box = node.box.grow(a).grow(b).grow(c)
+			centerBox = centerBox.grow(centroids[t])
+		}
+		index := len(tree.nodes)
+		tree.nodes = append(tree.nodes, node)
+		if end-start <= bvhLeafSize {
+			return index
+		}
+
+		// split down the middle of the longest axis
+		size := centerBox.Size()
+		axis := func(p Float3) float64 { return p.X }
+		if size.Y > size.X && size.Y >= size.Z {
+			axis = func(p Float3) float64 { return p.Y }
+		} else if size.Z > size.X && size.Z > size.Y {
+			axis = func(p Float3) float64 { return p.Z }
+		}
+		slices.SortFunc(tree.triangles[start:end], func(a, b int) int {
+			return cmpFloat(axis(centroids[a]), axis(centroids[b]))
+		})
+		mid := (start + end) / 2
+
+		left := build(start, mid)
+		right := build(mid, end)
+		tree.nodes[index].left, tree.nodes[index].right = left, right
+		return index
+	}
+	if len(tree.triangles) > 0 {
+		build(0, len(tree.triangles))
+	}
+	return tree
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cached bvh
+func (m *Mesh) getBVH() *bvh {
+	if m.bvh == nil {
+		m.bvh = buildBVH(m)
+	}
+	return m.bvh
+}
+
+// ---- ray tests
+
+// where the ray enters and leaves the space between two planes on one axis
+func slab(low, high, origin, invDir float64) (enter, leave float64) {
+	// running parallel to them, it's either in there the whole way or never.
+	// working it out would do 0 * inf when the origin is on a plane, which is NaN
+	if math.IsInf(invDir, 0) {
+		if origin < low || origin > high {
+			return math.Inf(1), math.Inf(-1)
+		}
+		return math.Inf(-1), math.Inf(1)
+	}
+	t0, t1 := (low-origin)*invDir, (high-origin)*invDir
+	return min(t0, t1), max(t0, t1)
+}
+
+// how far along the ray it enters the box, if it does before maxT
+func (a AABB) hitRay(origin, invDir Float3, maxT float64) (float64, bool) {
+	enterX, leaveX := slab(a.Min.X, a.Max.X, origin.X, invDir.X)
+	enterY, leaveY := slab(a.Min.Y, a.Max.Y, origin.Y, invDir.Y)
+	enterZ, leaveZ := slab(a.Min.Z, a.Max.Z, origin.Z, invDir.Z)
+	near := max(enterX, enterY, enterZ, 0)
+	far := min(leaveX, leaveY, leaveZ, maxT)
+	return near, near <= far
+}
+
+// möller-trumbore. both sides count. weights are for a, b and c
+func rayTriangle(origin, dir, a, b, c Float3) (t float64, weights Float3, ok bool) {
+	edge1, edge2 := b.sub(a), c.sub(a)
+	p := cross3(dir, edge2)
+	det := dot3(edge1, p)
+	if math.Abs(det) < 1e-12 {
+		return 0, Float3{}, false
+	}
+	invDet := 1 / det
+	s := origin.sub(a)
+	u := dot3(s, p) * invDet
+	if u < 0 || u > 1 {
+		return 0, Float3{}, false
+	}
+	q := cross3(s, edge1)
+	v := dot3(dir, q) * invDet
+	if v < 0 || u+v > 1 {
+		return 0, Float3{}, false
+	}
+	t = dot3(edge2, q) * invDet
+	return t, Float3{1 - u - v, u, v}, t > 0
+}
+
+// closest triangle the ray hits before maxT. dir doesn't need to be normalized, t is in units of it
+func (m *Mesh) raycast(origin, dir Float3, maxT float64) (triangle int, t float64, weights Float3, ok bool) {
+	tree := m.getBVH()
+	if len(tree.nodes) == 0 {
+		return
+	}
+	invDir := Float3{1 / dir.X, 1 / dir.Y, 1 / dir.Z}
+	t = maxT
+
+	stack := []int{0}
+	for len(stack) > 0 {
+		node := tree.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if _, hit := node.box.hitRay(origin, invDir, t); !hit {
+			continue
+		}
+		if node.left == 0 {
+			for _, tri := range tree.triangles[node.start:node.end] {
+				a, b, c := m.triangle(tri)
+				if hitT, w, hit := rayTriangle(origin, dir, a, b, c); hit && hitT < t {
+					triangle, t, weights, ok = tri, hitT, w, true
+				}
+			}
+			continue
+		}
+
+		// visit the nearer child first so the far one is more likely to get skipped
+		nearT, _ := tree.nodes[node.left].box.hitRay(origin, invDir, t)
+		farT, _ := tree.nodes[node.right].box.hitRay(origin, invDir, t)
+		if nearT < farT {
+			stack = append(stack, node.right, node.left)
+		} else {
+			stack = append(stack, node.left, node.right)
+		}
+	}
+	return
+}
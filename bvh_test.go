@@ -0,0 +1,67 @@
+package raster
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// closest hit by checking every triangle
+func bruteForceRaycast(m *Mesh, origin, dir Float3) (triangle int, t float64, ok bool) {
+	t = math.Inf(1)
+	for tri := range m.NumTriangles() {
+		a, b, c := m.triangle(tri)
+		if hitT, _, hit := rayTriangle(origin, dir, a, b, c); hit && hitT < t {
+			triangle, t, ok = tri, hitT, true
+		}
+	}
+	return
+}
+
+func TestBVHMatchesBruteForce(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	meshes := map[string]*Mesh{
+		"sphere": NewSphere("sphere", 1, 16, 12).Mesh,
+		"torus":  NewTorus("torus", 2, 0.5, 24, 12).Mesh,
+		"cube":   NewCube("cube", 2, 3).Mesh,
+	}
+	for name, mesh := range meshes {
+		hits := 0
+		for range 500 {
+			origin := Float3{random.Float64()*8 - 4, random.Float64()*8 - 4, random.Float64()*8 - 4}
+			target := Float3{random.Float64()*2 - 1, random.Float64()*2 - 1, random.Float64()*2 - 1}
+			dir := target.sub(origin)
+
+			wantTri, wantT, wantOk := bruteForceRaycast(mesh, origin, dir)
+			gotTri, gotT, _, gotOk := mesh.raycast(origin, dir, math.Inf(1))
+			if gotOk != wantOk {
+				t.Fatalf("%v: ray from %v along %v hit %v, want %v", name, origin, dir, gotOk, wantOk)
+			}
+			if !wantOk {
+				continue
+			}
+			hits++
+			// two triangles can share the hit point on an edge, so only the distance has to match
+			if math.Abs(gotT-wantT) > 1e-9 {
+				t.Fatalf("%v: hit triangle %v at %v, want %v at %v", name, gotTri, gotT, wantTri, wantT)
+			}
+		}
+		if hits == 0 {
+			t.Errorf("%v: no rays hit, the test isn't testing anything", name)
+		}
+	}
+}
+
+func TestHitRayParallelOnPlane(t *testing.T) {
+	box := AABB{Float3{0, 0, 0}, Float3{1, 1, 1}}
+	inv := func(d Float3) Float3 { return Float3{1 / d.X, 1 / d.Y, 1 / d.Z} }
+
+	// starts on the x = 0 face and runs along it
+	if _, hit := box.hitRay(Float3{0, 0.5, -1}, inv(Float3{0, 0, 1}), math.Inf(1)); !hit {
+		t.Error("ray along the box's face missed")
+	}
+	// parallel but outside
+	if _, hit := box.hitRay(Float3{-0.1, 0.5, -1}, inv(Float3{0, 0, 1}), math.Inf(1)); hit {
+		t.Error("ray beside the box hit it")
+	}
+}
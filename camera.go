@@ -0,0 +1,137 @@
+package raster
+
+import "math"
+
+// ------------ CAMERA -------------
+
+type Projection int
+
+const (
+	Perspective Projection = iota
+	Orthographic
+)
+
+// screen coordinates throughout are pixels in the rendered Image, with y
+// going up. the window shows the image flipped, see SoftwareRasterizer.Update.
+type Camera struct {
+	Transform  Transform // relative to parent, if it has one
+	Projection Projection
+	FOV        float64 // vertical field of view in radians, for perspective
+	OrthoSize  float64 // half the view height in world units, for orthographic
+	Near, Far  float64 // nothing closer than Near or further than Far gets drawn. 0 Far means no limit
+	Aspect     float64 // width over height. 0 uses the shape of whatever it renders into
+
+	parent *Model
+	view   Affine // world to view space, worked out at the start of each frame
+}
+
+func NewCamera() (c Camera) {
+	c.FOV = defaultFov
+	c.OrthoSize = defaultOrthoSize
+	c.Near = defaultNear
+	c.Far = defaultFar
+	c.Transform.Scale = Float3{1, 1, 1}
+	c.Transform.UpdateBases()
+	return
+}
+
+// fill in the view transform from wherever the camera currently is
+func (c *Camera) prepare() {
+	c.view = c.worldTransform().Inverse()
+}
+
+func (c Camera) aspect(numPixels Float2) float64 {
+	if c.Aspect > 0 {
+		return c.Aspect
+	}
+	return numPixels.X / numPixels.Y
+}
+
+// half the height of the view, in world units, at some depth
+func (c Camera) halfHeight(depth float64) float64 {
+	if c.Projection == Orthographic {
+		return c.OrthoSize
+	}
+	fov := c.FOV
+	if fov <= 0 {
+		fov = defaultFov
+	}
+	return math.Tan(fov/2) * depth
+}
+
+// view space to screen space. z stays the view depth
+func (c Camera) project(view Float3, numPixels Float2) Float3 {
+	halfHeight := c.halfHeight(view.Z)
+	halfWidth := halfHeight * c.aspect(numPixels)
+	return Float3{
+		numPixels.X/2 + view.X/halfWidth*numPixels.X/2,
+		numPixels.Y/2 + view.Y/halfHeight*numPixels.Y/2,
+		view.Z,
+	}
+}
+
+// screen space back to view space, at the given view depth
+func (c Camera) unproject(screen Float2, depth float64, numPixels Float2) Float3 {
+	halfHeight := c.halfHeight(depth)
+	halfWidth := halfHeight * c.aspect(numPixels)
+	return Float3{
+		(screen.X - numPixels.X/2) / (numPixels.X / 2) * halfWidth,
+		(screen.Y - numPixels.Y/2) / (numPixels.Y / 2) * halfHeight,
+		depth,
+	}
+}
+
+// how many pixels a world unit covers at some depth
+func (c Camera) pixelsPerUnit(depth float64, numPixels Float2) float64 {
+	return numPixels.Y / 2 / c.halfHeight(depth)
+}
+
+// Position is where the camera is in world space
+func (c Camera) Position() Float3 {
+	return c.worldTransform().Origin
+}
+
+// Forward is the direction the camera looks in world space
+func (c Camera) Forward() Float3 {
+	return c.worldTransform().Khat
+}
+
+// LookAt turns the camera to face a point in world space
+func (c *Camera) LookAt(target Float3) {
+	dir := target.sub(c.Position())
+	if c.parent != nil { // the rotation is relative to the parent
+		dir = c.parent.WorldTransform().withoutScale().Inverse().ApplyVector(dir)
+	}
+	dir = dir.normalized()
+	if dir == (Float3{}) {
+		return
+	}
+	c.Transform.SetRotation(math.Asin(clamp(dir.Y, -1, 1)), math.Atan2(-dir.X, dir.Z))
+}
+
+// WorldToScreen projects a point onto a target of numPixels. the returned z is
+// the view depth, and visible is false if the point is outside the view.
+func (c Camera) WorldToScreen(p Float3, numPixels Float2) (screen Float3, visible bool) {
+	view := c.worldTransform().Inverse().Apply(p)
+	if view.Z < c.Near || (c.Far > 0 && view.Z > c.Far) {
+		return Float3{}, false
+	}
+	screen = c.project(view, numPixels)
+	visible = screen.X >= 0 && screen.X < numPixels.X && screen.Y >= 0 && screen.Y < numPixels.Y
+	return
+}
+
+// ScreenToWorld is the point under a screen position, depth units in front of the camera
+func (c Camera) ScreenToWorld(screen Float2, depth float64, numPixels Float2) Float3 {
+	return c.worldTransform().Apply(c.unproject(screen, depth, numPixels))
+}
+
+// ScreenRay is the ray through a screen position, starting on the near plane
+func (c Camera) ScreenRay(screen Float2, numPixels Float2) (origin, dir Float3) {
+	near := max(c.Near, 1e-6)
+	origin = c.ScreenToWorld(screen, near, numPixels)
+	if c.Projection == Orthographic {
+		return origin, c.Forward()
+	}
+	return origin, origin.sub(c.Position()).normalized()
+}
@@ -0,0 +1,92 @@
+package raster
+
+import "container/list"
+
+// ------------ CHUNK CACHE -------------
+
+// generated chunks are kept around so walking back doesn't regenerate them.
+// once there are too many, the ones used longest ago get thrown out.
+
+type ChunkCacheStats struct {
+	Hits      uint64 // chunks that were wanted and already there
+	Misses    uint64 // chunks that had to be generated, or queued to be
+	Evictions uint64 // chunks thrown out to stay under the limits
+	Chunks    int    // how many are cached right now
+	Bytes     int    // rough memory use of the cached meshes
+}
+
+type cachedChunk struct {
+	key   chunkKey
+	model Model
+	bytes int
+}
+
+type chunkCache struct {
+	entries map[chunkKey]*list.Element // of *cachedChunk
+	lru     list.List                  // front is the most recently used
+	stats   ChunkCacheStats
+}
+
+func newChunkCache() *chunkCache {
+	return &chunkCache{entries: make(map[chunkKey]*list.Element)}
+}
+
+// look a chunk up, counting it as used. misses are counted by whoever makes the chunk
+func (c *chunkCache) get(key chunkKey) (Model, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return Model{}, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(element)
+	return element.Value.(*cachedChunk).model, true
+}
+
+// look a chunk up without counting it as used or a hit
+func (c *chunkCache) peek(key chunkKey) (Model, bool) {
+	if element, ok := c.entries[key]; ok {
+		return element.Value.(*cachedChunk).model, true
+	}
+	return Model{}, false
+}
+
+func (c *chunkCache) put(key chunkKey, model Model) {
+	if element, ok := c.entries[key]; ok {
+		c.stats.Bytes -= element.Value.(*cachedChunk).bytes
+		c.lru.Remove(element)
+	}
+	entry := &cachedChunk{key: key, model: model, bytes: model.Mesh.memorySize()}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.stats.Bytes += entry.bytes
+	c.stats.Chunks = len(c.entries)
+}
+
+// throw out the least recently used chunks until under the limits. a limit
+// of 0 means no limit. the newest keep chunks are never thrown out, so the
+// ones on screen survive even if the limits are tiny
+func (c *chunkCache) evict(maxChunks, maxBytes, keep int) {
+	over := func() bool {
+		return (maxChunks > 0 && len(c.entries) > maxChunks) || (maxBytes > 0 && c.stats.Bytes > maxBytes)
+	}
+	for over() && len(c.entries) > keep {
+		entry := c.lru.Remove(c.lru.Back()).(*cachedChunk)
+		delete(c.entries, entry.key)
+		c.stats.Bytes -= entry.bytes
+		c.stats.Evictions++
+	}
+	c.stats.Chunks = len(c.entries)
+}
+
+// change every cached chunk in place
+func (c *chunkCache) each(fn func(*Model)) {
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		fn(&element.Value.(*cachedChunk).model)
+	}
+}
+
+// rough bytes used by the mesh's vertex and index data
+func (m *Mesh) memorySize() int {
+	const float3Size, float2Size, intSize = 24, 16, 8
+	return (len(m.Positions)+len(m.Normals)+len(m.Tangents)+len(m.Bitangents))*float3Size +
+		len(m.TexCoords)*float2Size + len(m.Indices)*intSize
+}
@@ -0,0 +1,55 @@
+package raster
+
+import "testing"
+
+// a model whose mesh is 8 bytes per index, going by memorySize
+func cacheTestModel(indices int) Model {
+	return Model{Mesh: &Mesh{Indices: make([]int, indices)}}
+}
+
+func TestChunkCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newChunkCache()
+	for i := range 4 {
+		c.put(chunkKey{i, 0, 0}, cacheTestModel(1))
+	}
+	c.get(chunkKey{0, 0, 0}) // 1 is the oldest now
+	c.evict(2, 0, 0)
+
+	for i, want := range []bool{true, false, false, true} {
+		if _, ok := c.peek(chunkKey{i, 0, 0}); ok != want {
+			t.Errorf("chunk %v cached: %v, want %v", i, ok, want)
+		}
+	}
+	stats := c.stats
+	if stats.Evictions != 2 || stats.Chunks != 2 || stats.Hits != 1 || stats.Bytes != 16 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestChunkCacheMemoryBudgetAndKeep(t *testing.T) {
+	c := newChunkCache()
+	c.put(chunkKey{0, 0, 0}, cacheTestModel(10)) // 80 bytes
+	c.put(chunkKey{1, 0, 0}, cacheTestModel(10))
+	c.put(chunkKey{2, 0, 0}, cacheTestModel(10))
+
+	c.evict(0, 100, 0)
+	if c.stats.Chunks != 1 || c.stats.Bytes != 80 {
+		t.Errorf("after a 100 byte budget: %+v", c.stats)
+	}
+	if _, ok := c.peek(chunkKey{2, 0, 0}); !ok {
+		t.Error("the newest chunk was evicted")
+	}
+
+	// the newest keep chunks stay even over budget
+	c.put(chunkKey{3, 0, 0}, cacheTestModel(10))
+	c.evict(0, 1, 2)
+	if c.stats.Chunks != 2 {
+		t.Errorf("kept %v chunks, want 2", c.stats.Chunks)
+	}
+
+	// replacing a chunk doesn't count its old mesh twice
+	c.put(chunkKey{3, 0, 0}, cacheTestModel(1))
+	if c.stats.Bytes != 88 {
+		t.Errorf("bytes %v after replacing a chunk, want 88", c.stats.Bytes)
+	}
+}
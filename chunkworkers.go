@@ -0,0 +1,167 @@
+package raster
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+)
+
+// ------------ BACKGROUND CHUNK GENERATION -------------
+
+// missing chunks are generated by a pool of workers so the render call never
+// waits on them. until a chunk is ready a quick low resolution placeholder is
+// drawn in its place. the workers only ever touch the job they're given and
+// hand the result back under the lock, everything else stays on the render side.
+
+const placeholderResolution = 4
+
+type chunkJob struct {
+	key      chunkKey
+	priority float64 // squared distance to the camera, closest goes first
+	index    int     // in the heap
+
+	// everything needed to generate it, so workers never look at the chunker
+	gen        *terrainGen
+	resolution int
+	chunkSize  float64
+	skirt      float64
+	epoch      int
+}
+
+type chunkResult struct {
+	key   chunkKey
+	model Model
+	epoch int
+}
+
+// heap of jobs, see container/heap
+type chunkQueue []*chunkJob
+
+func (q chunkQueue) Len() int           { return len(q) }
+func (q chunkQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q chunkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *chunkQueue) Push(x any) {
+	job := x.(*chunkJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+func (q *chunkQueue) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return job
+}
+
+type chunkWorkers struct {
+	mu      sync.Mutex
+	wake    *sync.Cond
+	queue   chunkQueue
+	queued  map[chunkKey]*chunkJob
+	working map[chunkKey]bool
+	done    []chunkResult
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+func newChunkWorkers(count int) *chunkWorkers {
+	if count <= 0 {
+		count = max(1, runtime.NumCPU()-1) // leave one for rendering
+	}
+	w := &chunkWorkers{queued: make(map[chunkKey]*chunkJob), working: make(map[chunkKey]bool)}
+	w.wake = sync.NewCond(&w.mu)
+	w.wg.Add(count)
+	for range count {
+		go w.work()
+	}
+	return w
+}
+
+func (w *chunkWorkers) work() {
+	defer w.wg.Done()
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.wake.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		job := heap.Pop(&w.queue).(*chunkJob)
+		delete(w.queued, job.key)
+		w.working[job.key] = true
+		w.mu.Unlock()
+
+		model := buildChunk(job.gen, job.key, job.resolution, job.chunkSize, job.skirt)
+
+		w.mu.Lock()
+		delete(w.working, job.key)
+		w.done = append(w.done, chunkResult{job.key, model, job.epoch})
+		w.mu.Unlock()
+	}
+}
+
+// queue a chunk up, or move it up or down the queue if it's already waiting.
+// returns false if it was already queued, being worked on or finished and not collected yet
+func (w *chunkWorkers) request(job *chunkJob) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.working[job.key] {
+		return false
+	}
+	for _, result := range w.done {
+		if result.key == job.key && result.epoch == job.epoch {
+			return false
+		}
+	}
+	if queued, ok := w.queued[job.key]; ok {
+		queued.priority = job.priority
+		heap.Fix(&w.queue, queued.index)
+		return false
+	}
+	w.queued[job.key] = job
+	heap.Push(&w.queue, job)
+	w.wake.Signal()
+	return true
+}
+
+// drop queued jobs that aren't wanted any more. ones already started still finish
+func (w *chunkWorkers) keepOnly(wanted map[chunkKey]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, job := range w.queued {
+		if !wanted[key] {
+			heap.Remove(&w.queue, job.index)
+			delete(w.queued, key)
+		}
+	}
+}
+
+// take the finished chunks
+func (w *chunkWorkers) collect() []chunkResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	done := w.done
+	w.done = nil
+	return done
+}
+
+func (w *chunkWorkers) pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queue) + len(w.working)
+}
+
+// stop the workers once they finish what they're on
+func (w *chunkWorkers) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.queue = nil
+	clear(w.queued)
+	w.wake.Broadcast()
+	w.mu.Unlock()
+	w.wg.Wait()
+}
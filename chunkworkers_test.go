@@ -0,0 +1,40 @@
+package raster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChunkWorkersDontRedoFinishedChunks(t *testing.T) {
+	gen, err := newTerrainGen(DefaultTerrainConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newChunkWorkers(1)
+	defer w.close()
+	job := func(epoch int) *chunkJob {
+		return &chunkJob{key: chunkKey{1, 2, 0}, gen: gen, resolution: 4, chunkSize: 10, epoch: epoch}
+	}
+
+	if !w.request(job(0)) {
+		t.Fatal("first request was refused")
+	}
+	for w.pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// finished but not collected yet
+	if w.request(job(0)) {
+		t.Error("a finished chunk was queued again")
+	}
+	// made for old settings, so it's wanted again
+	if !w.request(job(1)) {
+		t.Error("a chunk from an old epoch wasn't queued again")
+	}
+	for w.pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if results := w.collect(); len(results) != 2 {
+		t.Errorf("collected %v chunks, want 2", len(results))
+	}
+}
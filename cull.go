@@ -0,0 +1,119 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+)
+
+// ------------ FRUSTUM CULLING -------------
+
+// a plane in view space, points with dot(normal, p) + offset >= 0 are inside
+type plane struct {
+	normal Float3
+	offset float64
+}
+
+func (p plane) distance(point Float3) float64 {
+	return dot3(p.normal, point) + p.offset
+}
+
+// what the camera can see, as planes facing inwards
+type frustum []plane
+
+func newFrustum(cam Camera, numPixels Float2) frustum {
+	f := frustum{{Float3{0, 0, 1}, -max(cam.Near, 0)}}
+	if cam.Far > 0 {
+		f = append(f, plane{Float3{0, 0, -1}, cam.Far})
+	}
+
+	if cam.Projection == Orthographic {
+		halfHeight := cam.OrthoSize
+		halfWidth := halfHeight * cam.aspect(numPixels)
+		return append(f,
+			plane{Float3{1, 0, 0}, halfWidth},
+			plane{Float3{-1, 0, 0}, halfWidth},
+			plane{Float3{0, 1, 0}, halfHeight},
+			plane{Float3{0, -1, 0}, halfHeight},
+		)
+	}
+
+	// side planes go through the camera, so they're just a slope each
+	tanY := cam.halfHeight(1)
+	tanX := tanY * cam.aspect(numPixels)
+	return append(f,
+		plane{Float3{1, 0, tanX}.normalized(), 0},
+		plane{Float3{-1, 0, tanX}.normalized(), 0},
+		plane{Float3{0, 1, tanY}.normalized(), 0},
+		plane{Float3{0, -1, tanY}.normalized(), 0},
+	)
+}
+
+// is the mesh, placed with toView (model to view space), definitely out of sight.
+// the cheap sphere test goes first, then the box corners for anything it lets through
+func (f frustum) culls(mesh *Mesh, toView Affine) bool {
+	sphere := mesh.bounds()
+	center := toView.Apply(sphere.Center)
+	radius := sphere.Radius * toView.maxScale()
+	for _, p := range f {
+		if p.distance(center) < -radius {
+			return true
+		}
+	}
+
+	box := mesh.boundingBox()
+	var corners [8]Float3
+	for i := range corners {
+		corner := box.Min
+		if i&1 != 0 {
+			corner.X = box.Max.X
+		}
+		if i&2 != 0 {
+			corner.Y = box.Max.Y
+		}
+		if i&4 != 0 {
+			corner.Z = box.Max.Z
+		}
+		corners[i] = toView.Apply(corner)
+	}
+	for _, p := range f {
+		outside := true
+		for _, corner := range corners {
+			if p.distance(corner) >= 0 {
+				outside = false
+				break
+			}
+		}
+		if outside {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- stats
+
+// RenderStats counts what happened while drawing the last frame, over every viewport
+type RenderStats struct {
+	Models       int // models drawn
+	ModelsCulled int // models skipped for being out of view
+	Chunks       int // terrain chunks drawn
+	ChunksCulled int
+	Triangles    int // triangles sent to the rasterizer
+}
+
+var stats, lastStats RenderStats
+
+// Stats are the numbers from the last finished frame
+func Stats() RenderStats {
+	return lastStats
+}
+
+func (s RenderStats) String() string {
+	culled := s.ModelsCulled + s.ChunksCulled
+	percent := 0.0
+	if total := s.Models + s.Chunks + culled; total > 0 {
+		percent = math.Round(float64(culled) / float64(total) * 100)
+	}
+	return fmt.Sprintf("models %v/%v, chunks %v/%v, tris %v, %v%% culled",
+		s.Models, s.Models+s.ModelsCulled, s.Chunks, s.Chunks+s.ChunksCulled, s.Triangles, percent)
+}
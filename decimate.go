@@ -0,0 +1,423 @@
+package raster
+
+import (
+	"container/heap"
+	"math"
+)
+
+// ------------ SIMPLIFICATION -------------
+
+// symmetric 4x4 error quadric, upper triangle: aa ab ac ad bb bc bd cc cd dd
+type quadric [10]float64
+
+// quadric measuring squared distance to the plane n.p + d = 0
+func planeQuadric(n Float3, d, weight float64) quadric {
+	a, b, c := n.X, n.Y, n.Z
+	return quadric{
+		a * a * weight, a * b * weight, a * c * weight, a * d * weight,
+		b * b * weight, b * c * weight, b * d * weight,
+		c * c * weight, c * d * weight,
+		d * d * weight,
+	}
+}
+
+func (q quadric) add(o quadric) (r quadric) {
+	for i := range q {
+		r[i] = q[i] + o[i]
+	}
+	return
+}
+
+func (q quadric) eval(p Float3) float64 {
+	x, y, z := p.X, p.Y, p.Z
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// candidate edge collapse, moving position from onto position to
+type collapse struct {
+	cost               float64
+	from, to           int
+	fromStamp, toStamp int
+}
+
+type collapseHeap []collapse
+
+func (h collapseHeap) Len() int           { return len(h) }
+func (h collapseHeap) Less(i, j int) bool { return h[i].cost < h[j].cost }
+func (h collapseHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *collapseHeap) Push(x any)        { *h = append(*h, x.(collapse)) }
+func (h *collapseHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// normals further apart than this count as a hard edge that simplification tries to keep
+const hardEdgeAngle float64 = 35 * math.Pi / 180
+
+// boundary, seam and hard edges weigh this much more than the surface itself
+const seamPenalty float64 = 1000
+
+// edge collapse state. the mesh is welded by position for the topology, while
+// triangles keep pointing at the original vertices so uv and normal seams survive.
+type decimator struct {
+	mesh      *Mesh
+	posOf     []int    // vertex -> welded position
+	positions []Float3 // welded positions
+	quadrics  []quadric
+	stamps    []int // bumped whenever a position changes, to skip stale heap entries
+	tris      [][3]int
+	alive     []bool
+	trisAt    [][]int // position -> triangles that touched it at some point
+	queue     collapseHeap
+}
+
+func newDecimator(mesh *Mesh) *decimator {
+	d := &decimator{mesh: mesh, posOf: make([]int, len(mesh.Positions))}
+
+	lookup := make(map[Float3]int)
+	for i, p := range mesh.Positions {
+		id, ok := lookup[p]
+		if !ok {
+			id = len(d.positions)
+			d.positions = append(d.positions, p)
+			lookup[p] = id
+		}
+		d.posOf[i] = id
+	}
+	d.quadrics = make([]quadric, len(d.positions))
+	d.stamps = make([]int, len(d.positions))
+	d.trisAt = make([][]int, len(d.positions))
+
+	type edgeSide struct {
+		tri      int
+		from, to int // vertices, in winding order
+	}
+	edges := make(map[[2]int][]edgeSide)
+
+	for i := 0; i+2 < len(mesh.Indices); i += 3 {
+		tri := [3]int{mesh.Indices[i], mesh.Indices[i+1], mesh.Indices[i+2]}
+		t := len(d.tris)
+		d.tris = append(d.tris, tri)
+		d.alive = append(d.alive, true)
+
+		a, b, c := mesh.Positions[tri[0]], mesh.Positions[tri[1]], mesh.Positions[tri[2]]
+		scaled := cross3(b.sub(a), c.sub(b))
+		normal := scaled.normalized()
+		q := planeQuadric(normal, -dot3(normal, a), scaled.magnitude()/2)
+
+		for k := range 3 {
+			p := d.posOf[tri[k]]
+			d.quadrics[p] = d.quadrics[p].add(q)
+			d.trisAt[p] = append(d.trisAt[p], t)
+
+			from, to := tri[k], tri[(k+1)%3]
+			key := [2]int{min(d.posOf[from], d.posOf[to]), max(d.posOf[from], d.posOf[to])}
+			edges[key] = append(edges[key], edgeSide{t, from, to})
+		}
+	}
+
+	// keep open borders and attribute seams in place with planes standing on those edges
+	for key, sides := range edges {
+		seam := len(sides) != 2
+		if !seam {
+			s0, s1 := sides[0], sides[1]
+			seam = !d.sameWedge(s0.from, s1.to) || !d.sameWedge(s0.to, s1.from) ||
+				d.hardEdge(s0.from, s1.to) || d.hardEdge(s0.to, s1.from)
+		}
+		if !seam {
+			continue
+		}
+		a, b := d.positions[key[0]], d.positions[key[1]]
+		edge := b.sub(a)
+		for _, side := range sides {
+			tri := d.tris[side.tri]
+			faceNormal := triangleNormal(mesh.Positions[tri[0]], mesh.Positions[tri[1]], mesh.Positions[tri[2]])
+			normal := cross3(edge, faceNormal).normalized()
+			q := planeQuadric(normal, -dot3(normal, a), seamPenalty*dot3(edge, edge))
+			d.quadrics[key[0]] = d.quadrics[key[0]].add(q)
+			d.quadrics[key[1]] = d.quadrics[key[1]].add(q)
+		}
+	}
+
+	for key := range edges {
+		d.pushEdge(key[0], key[1])
+	}
+	return d
+}
+
+func (d *decimator) pushEdge(a, b int) {
+	q := d.quadrics[a].add(d.quadrics[b])
+	heap.Push(&d.queue, collapse{q.eval(d.positions[b]), a, b, d.stamps[a], d.stamps[b]})
+	heap.Push(&d.queue, collapse{q.eval(d.positions[a]), b, a, d.stamps[b], d.stamps[a]})
+}
+
+// can vertices a and b be treated as one, meaning no uv seam runs between them.
+// normals aren't compared, they get rebuilt afterwards
+func (d *decimator) sameWedge(a, b int) bool {
+	return a == b || d.mesh.TexCoords[a].sub(d.mesh.TexCoords[b]).magnitude() < 1e-6
+}
+
+// is this a hard edge between two triangles
+func (d *decimator) hardEdge(a, b int) bool {
+	return dot3(d.mesh.Normals[a].normalized(), d.mesh.Normals[b].normalized()) < math.Cos(hardEdgeAngle)
+}
+
+func (d *decimator) cornerAt(t, p int) int {
+	for k, v := range d.tris[t] {
+		if d.posOf[v] == p {
+			return k
+		}
+	}
+	return -1
+}
+
+// alive triangles around a position
+func (d *decimator) around(p int) (tris []int) {
+	for _, t := range d.trisAt[p] {
+		if d.alive[t] && d.cornerAt(t, p) >= 0 && indexOf(tris, t) < 0 {
+			tris = append(tris, t)
+		}
+	}
+	d.trisAt[p] = tris // drop the dead ones while we're here
+	return
+}
+
+// how many triangles each neighbouring position shares with p
+func (d *decimator) neighbours(p int, tris []int) map[int]int {
+	counts := make(map[int]int)
+	for _, t := range tris {
+		for _, v := range d.tris[t] {
+			if q := d.posOf[v]; q != p {
+				counts[q]++
+			}
+		}
+	}
+	return counts
+}
+
+// check if from can be collapsed onto to, returning how its vertices map onto to's
+func (d *decimator) canCollapse(from, to int) (remap map[int]int, ok bool) {
+	fromTris := d.around(from)
+	toTris := d.around(to)
+
+	remap = make(map[int]int)
+	shared := 0
+	for _, t := range fromTris {
+		if k := d.cornerAt(t, to); k >= 0 {
+			shared++
+			remap[d.tris[t][d.cornerAt(t, from)]] = d.tris[t][k]
+		}
+	}
+	if shared == 0 || shared > 2 {
+		return nil, false
+	}
+
+	// every vertex at from needs a partner across the edge, otherwise the collapse would tear a seam
+	for _, t := range fromTris {
+		v := d.tris[t][d.cornerAt(t, from)]
+		if _, mapped := remap[v]; mapped {
+			continue
+		}
+		for other, target := range remap {
+			if d.sameWedge(v, other) {
+				remap[v] = target
+				break
+			}
+		}
+		if _, mapped := remap[v]; !mapped {
+			return nil, false
+		}
+	}
+
+	// border positions may only slide along the border
+	fromNeighbours := d.neighbours(from, fromTris)
+	for _, count := range fromNeighbours {
+		if count == 1 && shared != 1 {
+			return nil, false
+		}
+	}
+
+	// link condition, so the surface stays manifold
+	common := 0
+	for p := range d.neighbours(to, toTris) {
+		if _, ok := fromNeighbours[p]; ok {
+			common++
+		}
+	}
+	if common != shared {
+		return nil, false
+	}
+
+	// no triangle may flip over or collapse to nothing
+	for _, t := range fromTris {
+		if d.cornerAt(t, to) >= 0 {
+			continue
+		}
+		var before, after [3]Float3
+		for k, v := range d.tris[t] {
+			before[k] = d.positions[d.posOf[v]]
+			after[k] = before[k]
+			if d.posOf[v] == from {
+				after[k] = d.positions[to]
+			}
+		}
+		n0 := cross3(before[1].sub(before[0]), before[2].sub(before[1]))
+		n1 := cross3(after[1].sub(after[0]), after[2].sub(after[1]))
+		if n1.magnitude() < 1e-12 || dot3(n0.normalized(), n1.normalized()) < 0.2 {
+			return nil, false
+		}
+	}
+
+	return remap, true
+}
+
+func (d *decimator) collapse(from, to int, remap map[int]int) (removed int) {
+	for _, t := range d.around(from) {
+		if d.cornerAt(t, to) >= 0 {
+			d.alive[t] = false
+			removed++
+			continue
+		}
+		k := d.cornerAt(t, from)
+		d.tris[t][k] = remap[d.tris[t][k]]
+		d.trisAt[to] = append(d.trisAt[to], t)
+	}
+
+	d.quadrics[to] = d.quadrics[to].add(d.quadrics[from])
+	d.stamps[from]++
+	d.stamps[to]++
+
+	for neighbour := range d.neighbours(to, d.around(to)) {
+		d.pushEdge(to, neighbour)
+	}
+	return
+}
+
+func (d *decimator) run(targetTriangles int) *Mesh {
+	remaining := len(d.tris)
+	for remaining > targetTriangles && d.queue.Len() > 0 {
+		c := heap.Pop(&d.queue).(collapse)
+		if c.fromStamp != d.stamps[c.from] || c.toStamp != d.stamps[c.to] {
+			continue // something moved since this was queued
+		}
+		remap, ok := d.canCollapse(c.from, c.to)
+		if !ok {
+			continue
+		}
+		remaining -= d.collapse(c.from, c.to, remap)
+	}
+
+	// compact whatever vertices are still used
+	out := &Mesh{}
+	newIndex := make(map[int]int)
+	for t, tri := range d.tris {
+		if !d.alive[t] {
+			continue
+		}
+		for _, v := range tri {
+			i, ok := newIndex[v]
+			if !ok {
+				i = out.appendVertex(d.mesh.Positions[v], d.mesh.TexCoords[v], d.mesh.Normals[v])
+				newIndex[v] = i
+			}
+			out.Indices = append(out.Indices, i)
+		}
+	}
+
+	// the surface moved, so rebuild normals the same way the source was shaded
+	if d.mesh.flatShaded() {
+		out.RecomputeNormals(0)
+	} else {
+		out.RecomputeNormals(hardEdgeAngle)
+	}
+	return out
+}
+
+// does every corner just use its triangle's normal
+func (m *Mesh) flatShaded() bool {
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		a, b, c := m.Indices[i], m.Indices[i+1], m.Indices[i+2]
+		normal := triangleNormal(m.Positions[a], m.Positions[b], m.Positions[c])
+		for _, v := range []int{a, b, c} {
+			if dot3(normal, m.Normals[v].normalized()) < 0.999 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Simplify returns a copy of the mesh reduced towards targetTriangles using
+// quadric error edge collapses. open borders and uv seams are kept and hard
+// edges are avoided, so it may stop short of the target.
+func (m *Mesh) Simplify(targetTriangles int) *Mesh {
+	return newDecimator(m).run(targetTriangles)
+}
+
+// GenerateLODs builds the chain of simplified meshes used at a distance, one
+// per target triangle count. with no targets it keeps halving the triangle
+// count a few times. terrain chunks don't go through this, the chunker builds
+// coarser chunks straight from the terrain instead (see ChunkerOptions.LODLevels)
+func (m *Model) GenerateLODs(targets ...int) {
+	if m.Mesh == nil {
+		m.BuildMesh()
+	}
+	if len(targets) == 0 {
+		for n := m.Mesh.NumTriangles() / 2; n >= 8 && len(targets) < 4; n /= 2 {
+			targets = append(targets, n)
+		}
+	}
+
+	// a new slice, drawn copies of the model may still hold the old one
+	m.LODs = nil
+	m.lodSource, m.lodEdits = m.Mesh, m.Mesh.edits
+	source := m.Mesh
+	for _, target := range targets {
+		lod := source.Simplify(target)
+		if lod.NumTriangles() >= source.NumTriangles() {
+			break // can't get any simpler
+		}
+		m.LODs = append(m.LODs, lod)
+		source = lod
+	}
+}
+
+// drop lods built from geometry that has changed since, the mesh was replaced
+// or edited (Weld, Center, FlipWinding and so on all call Invalidate)
+func (m *Model) dropStaleLODs() {
+	if m.lodSource != nil && (m.lodSource != m.Mesh || m.lodEdits != m.Mesh.edits) {
+		m.LODs, m.lodSource = nil, nil
+	}
+}
+
+// pick the mesh to draw, going by roughly how many pixels the model covers
+func (m Model) selectLOD(cam Camera, numPixels Float2) *Mesh {
+	mesh := m.getMesh()
+	if len(m.LODs) == 0 {
+		return mesh
+	}
+
+	sphere := mesh.bounds()
+	radius := sphere.Radius * m.world.maxScale()
+	depth := cam.view.Apply(m.world.Apply(sphere.Center)).Z
+	if depth <= radius {
+		return mesh // we're inside it or right up against it
+	}
+
+	// how big the bounding sphere looks on screen
+	pixelRadius := radius * cam.pixelsPerUnit(depth, numPixels)
+	wanted := math.Pi * pixelRadius * pixelRadius / lodPixelsPerTriangle
+
+	// coarsest level that still has enough triangles
+	for i := len(m.LODs) - 1; i >= 0; i-- {
+		if float64(m.LODs[i].NumTriangles()) >= wanted {
+			return m.LODs[i]
+		}
+	}
+	return mesh
+}
@@ -0,0 +1,85 @@
+package raster
+
+import "testing"
+
+func checkIndices(t *testing.T, name string, m *Mesh) {
+	t.Helper()
+	if len(m.Indices)%3 != 0 {
+		t.Fatalf("%v: %v indices isn't whole triangles", name, len(m.Indices))
+	}
+	for _, i := range m.Indices {
+		if i < 0 || i >= len(m.Positions) {
+			t.Fatalf("%v: index %v out of %v vertices", name, i, len(m.Positions))
+		}
+	}
+}
+
+func TestSimplifyHitsTriangleTargets(t *testing.T) {
+	sphere := NewSphere("sphere", 1, 32, 16).Mesh
+	for _, target := range []int{500, 200, 50} {
+		simple := sphere.Simplify(target)
+		checkIndices(t, "sphere", simple)
+		if got := simple.NumTriangles(); got > target || got < target*9/10 {
+			t.Errorf("simplified to %v triangles, want about %v", got, target)
+		}
+		if size := simple.BoundingBox().Size(); size.X < 1.8 || size.Y < 1.8 || size.Z < 1.8 {
+			t.Errorf("simplifying to %v shrank the sphere to %v", target, size)
+		}
+	}
+	if sphere.NumTriangles() != 960 {
+		t.Errorf("Simplify changed the original mesh")
+	}
+}
+
+func TestSimplifyKeepsFlatPlaneAndBorders(t *testing.T) {
+	plane := NewPlane("plane", 4, 4, 10, 10).Mesh
+	simple := plane.Simplify(20)
+	checkIndices(t, "plane", simple)
+	if simple.NumTriangles() >= plane.NumTriangles() {
+		t.Fatalf("plane wasn't simplified, still %v triangles", simple.NumTriangles())
+	}
+	for _, p := range simple.Positions {
+		if p.Y != 0 {
+			t.Fatalf("flat plane got bent, point %v", p)
+		}
+	}
+	if simple.BoundingBox() != plane.BoundingBox() {
+		t.Errorf("border moved from %v to %v", plane.BoundingBox(), simple.BoundingBox())
+	}
+}
+
+func TestGenerateLODsHalves(t *testing.T) {
+	model := NewSphere("sphere", 1, 32, 16)
+	model.GenerateLODs()
+	want := []int{480, 240, 120, 60}
+	if len(model.LODs) != len(want) {
+		t.Fatalf("%v lods, want %v", len(model.LODs), len(want))
+	}
+	for i, lod := range model.LODs {
+		if lod.NumTriangles() != want[i] {
+			t.Errorf("lod %v has %v triangles, want %v", i, lod.NumTriangles(), want[i])
+		}
+	}
+}
+
+func TestEditingTheMeshDropsLODs(t *testing.T) {
+	model := NewSphere("sphere", 1, 32, 16)
+	model.GenerateLODs()
+	lods := model.LODs
+	model.dropStaleLODs()
+	if len(model.LODs) == 0 {
+		t.Fatal("lods dropped without the mesh changing")
+	}
+
+	model.Mesh.Center()
+	model.dropStaleLODs()
+	if model.LODs != nil {
+		t.Error("lods kept after the mesh was moved")
+	}
+
+	// regenerating doesn't write into the old slice, drawn copies may still use it
+	model.GenerateLODs()
+	if &model.LODs[0] == &lods[0] {
+		t.Error("GenerateLODs reused the old lod slice")
+	}
+}
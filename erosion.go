@@ -0,0 +1,318 @@
+package raster
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// ------------ EROSION -------------
+
+// erosion runs on square tiles of a grid that covers the whole world, not on
+// chunks, so every chunk (and every lod level) reads the same eroded ground and
+// neighbours line up. tiles overlap by half and fade out towards their edges,
+// every point is covered by four of them whose fades add up to 1, so there are
+// no seams where one tile's simulation stops.
+// a tile only stores how much the ground moved, that gets added on top of the
+// normal elevation
+
+// ErosionConfig says how the terrain gets worn down. set TerrainConfig.Erosion
+// to use it, starting from DefaultErosionConfig. the same seed always erodes
+// the same way
+type ErosionConfig struct {
+	CellSize  float64 // world units between points of the simulated grid
+	TileCells int     // cells across a tile. bigger tiles let rivers run further
+
+	// hydraulic, rain drops running downhill picking up and dropping dirt
+	Droplets    int     // per tile, 0 turns it off
+	Lifetime    int     // steps a droplet takes before it's done
+	Inertia     float64 // 0 to 1, how much droplets keep going their way instead of straight downhill
+	Capacity    float64 // how much dirt water can carry, times how fast and steep it goes. not negative
+	ErodeRate   float64 // 0 to 1
+	DepositRate float64 // 0 to 1
+	Evaporation float64 // 0 to 1, water lost each step
+	Gravity     float64 // speeds droplets up going downhill, not negative
+	Radius      int     // cells around a droplet that get worn away
+
+	// thermal, steep slopes crumbling until they settle
+	ThermalIterations int     // 0 turns it off
+	TalusSlope        float64 // steepest slope (height over distance) that stays put, not negative
+	ThermalRate       float64 // 0 to 0.5, how much of the extra slides down each iteration
+}
+
+func DefaultErosionConfig() ErosionConfig {
+	return ErosionConfig{
+		CellSize:          0.5,
+		TileCells:         64,
+		Droplets:          3000,
+		Lifetime:          30,
+		Inertia:           0.05,
+		Capacity:          4,
+		ErodeRate:         0.3,
+		DepositRate:       0.3,
+		Evaporation:       0.02,
+		Gravity:           4,
+		Radius:            2,
+		ThermalIterations: 20,
+		TalusSlope:        1.2,
+		ThermalRate:       0.25,
+	}
+}
+
+func (c ErosionConfig) validate() error {
+	switch {
+	case !(c.CellSize > 0): // written this way round so NaN fails
+		return errors.New("erosion cell size has to be positive")
+	case c.TileCells < 4:
+		return errors.New("erosion tiles need at least 4 cells")
+	case c.Droplets < 0 || c.Lifetime < 0 || c.Radius < 0 || c.ThermalIterations < 0:
+		return errors.New("erosion counts can't be negative")
+	case !inRange(c.Inertia, 0, 1) || !inRange(c.Evaporation, 0, 1):
+		return errors.New("erosion inertia and evaporation go from 0 to 1")
+	case !inRange(c.ErodeRate, 0, 1) || !inRange(c.DepositRate, 0, 1):
+		return errors.New("erosion erode and deposit rates go from 0 to 1")
+	case !(c.Capacity >= 0) || !(c.Gravity >= 0):
+		return errors.New("erosion capacity and gravity can't be negative")
+	case !(c.TalusSlope >= 0):
+		return errors.New("talus slope can't be negative")
+	case !inRange(c.ThermalRate, 0, 0.5):
+		return errors.New("thermal rate goes from 0 to 0.5")
+	}
+	return nil
+}
+
+// NaN fails too
+func inRange(v, low, high float64) bool {
+	return v >= low && v <= high
+}
+
+// tiles kept around, cleared when full
+const erosionCacheSize = 256
+
+// eroded tiles for one terrainGen. chunk workers share it, so it's locked
+type erosionTiles struct {
+	gen    *terrainGen
+	config ErosionConfig
+	step   float64 // world distance between tile corners, half a tile
+
+	mu    sync.Mutex
+	tiles map[[2]int]*Heightmap // change in height per grid point, not 0 to 1 here
+}
+
+func newErosionTiles(gen *terrainGen, config ErosionConfig) *erosionTiles {
+	return &erosionTiles{
+		gen:    gen,
+		config: config,
+		step:   float64(config.TileCells) * config.CellSize / 2,
+		tiles:  make(map[[2]int]*Heightmap),
+	}
+}
+
+// how much erosion moved the ground at pos
+func (e *erosionTiles) delta(pos Float2) float64 {
+	kx, ky := int(math.Floor(pos.X/e.step)), int(math.Floor(pos.Y/e.step))
+	total := 0.0
+	for ty := ky - 1; ty <= ky; ty++ {
+		for tx := kx - 1; tx <= kx; tx++ {
+			local := pos.sub(Float2{float64(tx), float64(ty)}.mulscal(e.step))
+			// sin² on one tile and cos² on the overlapping one, so they add up to 1
+			fadeX := math.Sin(math.Pi * local.X / (2 * e.step))
+			fadeY := math.Sin(math.Pi * local.Y / (2 * e.step))
+			weight := fadeX * fadeX * fadeY * fadeY
+			if weight == 0 {
+				continue
+			}
+			cell := local.mulscal(1 / e.config.CellSize)
+			total += weight * e.tile(tx, ty).sample(cell.X, cell.Y)
+		}
+	}
+	return total
+}
+
+func (e *erosionTiles) tile(tx, ty int) *Heightmap {
+	key := [2]int{tx, ty}
+	e.mu.Lock()
+	tile, ok := e.tiles[key]
+	e.mu.Unlock()
+	if ok {
+		return tile
+	}
+
+	// worked out without the lock, two workers might both do a tile but they get the same answer
+	tile = e.erode(tx, ty)
+
+	e.mu.Lock()
+	if len(e.tiles) >= erosionCacheSize {
+		e.tiles = make(map[[2]int]*Heightmap)
+	}
+	e.tiles[key] = tile
+	e.mu.Unlock()
+	return tile
+}
+
+func (e *erosionTiles) erode(tx, ty int) *Heightmap {
+	cfg := e.config
+	size := cfg.TileCells + 1
+	origin := Float2{float64(tx), float64(ty)}.mulscal(e.step)
+	ground := NewHeightmap(size, size)
+	for y := range size {
+		for x := range size {
+			pos := origin.add(Float2{float64(x), float64(y)}.mulscal(cfg.CellSize))
+			ground.Set(x, y, e.gen.rawElevation(pos))
+		}
+	}
+	before := append([]float64(nil), ground.Heights...)
+
+	seed := uint64(tx)<<32 | uint64(uint32(ty))
+	random := rand.New(rand.NewPCG(uint64(e.gen.config.Seed), seed))
+	erodeHydraulic(ground, cfg, random)
+	erodeThermal(ground, cfg)
+
+	for i := range ground.Heights {
+		ground.Heights[i] -= before[i]
+	}
+	return ground
+}
+
+// ---- hydraulic
+
+type brushCell struct {
+	dx, dy int
+	weight float64
+}
+
+// cells within radius, closer ones weigh more, adding up to 1
+func erosionBrush(radius int) []brushCell {
+	var brush []brushCell
+	total := 0.0
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			weight := float64(radius) + 1 - math.Hypot(float64(dx), float64(dy))
+			if weight > 0 {
+				brush = append(brush, brushCell{dx, dy, weight})
+				total += weight
+			}
+		}
+	}
+	for i := range brush {
+		brush[i].weight /= total
+	}
+	return brush
+}
+
+// height and downhill slope at a point between cells
+func heightAndGradient(ground *Heightmap, pos Float2) (float64, Float2) {
+	x, y := int(pos.X), int(pos.Y)
+	fx, fy := pos.X-float64(x), pos.Y-float64(y)
+	a, b := ground.At(x, y), ground.At(x+1, y)
+	c, d := ground.At(x, y+1), ground.At(x+1, y+1)
+	gradient := Float2{(b-a)*(1-fy) + (d-c)*fy, (c-a)*(1-fx) + (d-b)*fx}
+	return ground.sample(pos.X, pos.Y), gradient
+}
+
+// spread an amount over the four cells around pos
+func depositAt(ground *Heightmap, pos Float2, amount float64) {
+	x, y := int(pos.X), int(pos.Y)
+	fx, fy := pos.X-float64(x), pos.Y-float64(y)
+	ground.Heights[y*ground.Width+x] += amount * (1 - fx) * (1 - fy)
+	ground.Heights[y*ground.Width+x+1] += amount * fx * (1 - fy)
+	ground.Heights[(y+1)*ground.Width+x] += amount * (1 - fx) * fy
+	ground.Heights[(y+1)*ground.Width+x+1] += amount * fx * fy
+}
+
+const minErosionCapacity = 0.01
+
+func erodeHydraulic(ground *Heightmap, cfg ErosionConfig, random *rand.Rand) {
+	brush := erosionBrush(cfg.Radius)
+	last := float64(ground.Width - 1)
+
+	for range cfg.Droplets {
+		pos := Float2{random.Float64() * last, random.Float64() * last}
+		dir := Float2{}
+		speed, water, sediment := 1.0, 1.0, 0.0
+
+		for range cfg.Lifetime {
+			height, gradient := heightAndGradient(ground, pos)
+			dir = dir.mulscal(cfg.Inertia).sub(gradient.mulscal(1 - cfg.Inertia))
+			length := math.Hypot(dir.X, dir.Y)
+			if length == 0 { // flat, nowhere to go
+				break
+			}
+			dir = dir.mulscal(1 / length)
+			next := pos.add(dir)
+			if next.X < 0 || next.Y < 0 || next.X >= last || next.Y >= last {
+				break // ran off the tile
+			}
+
+			nextHeight, _ := heightAndGradient(ground, next)
+			drop := nextHeight - height
+			capacity := max(-drop*speed*water*cfg.Capacity, minErosionCapacity)
+
+			if drop > 0 || sediment > capacity {
+				// going uphill fills the hole behind, otherwise drop what it can't carry
+				amount := (sediment - capacity) * cfg.DepositRate
+				if drop > 0 {
+					amount = min(drop, sediment)
+				}
+				sediment -= amount
+				depositAt(ground, pos, amount)
+			} else {
+				// never dig deeper than the drop, that would make pits
+				amount := min((capacity-sediment)*cfg.ErodeRate, -drop)
+				x, y := int(pos.X), int(pos.Y)
+				for _, b := range brush {
+					bx, by := x+b.dx, y+b.dy
+					if bx < 0 || by < 0 || bx >= ground.Width || by >= ground.Height {
+						continue
+					}
+					ground.Heights[by*ground.Width+bx] -= amount * b.weight
+					sediment += amount * b.weight
+				}
+			}
+
+			speed = math.Sqrt(max(0, speed*speed-drop*cfg.Gravity))
+			water *= 1 - cfg.Evaporation
+			pos = next
+		}
+	}
+}
+
+// ---- thermal
+
+func erodeThermal(ground *Heightmap, cfg ErosionConfig) {
+	limit := cfg.TalusSlope * cfg.CellSize
+	moved := make([]float64, len(ground.Heights))
+
+	// each pair of neighbours, only right and down so nothing is done twice
+	slide := func(a, b int) {
+		diff := ground.Heights[a] - ground.Heights[b]
+		if math.Abs(diff) <= limit {
+			return
+		}
+		amount := cfg.ThermalRate * (math.Abs(diff) - limit) / 2
+		if diff < 0 {
+			amount = -amount
+		}
+		moved[a] -= amount
+		moved[b] += amount
+	}
+
+	for range cfg.ThermalIterations {
+		clear(moved)
+		for y := range ground.Height {
+			for x := range ground.Width {
+				i := y*ground.Width + x
+				if x+1 < ground.Width {
+					slide(i, i+1)
+				}
+				if y+1 < ground.Height {
+					slide(i, i+ground.Width)
+				}
+			}
+		}
+		for i := range moved {
+			ground.Heights[i] += moved[i]
+		}
+	}
+}
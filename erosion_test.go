@@ -0,0 +1,122 @@
+package raster
+
+import (
+	"math"
+	"testing"
+)
+
+// small and quick, but still moving plenty of ground
+func testErosionTerrain(seed int64) TerrainConfig {
+	erosion := DefaultErosionConfig()
+	erosion.TileCells = 16
+	erosion.Droplets = 300
+	config := DefaultTerrainConfig()
+	config.Seed = seed
+	config.Erosion = &erosion
+	return config
+}
+
+func TestErosionDeltaIsContinuousAcrossTiles(t *testing.T) {
+	gen, err := newTerrainGen(testErosionTerrain(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := gen.erosion
+	const nudge = 1e-7
+	moved := 0.0
+	for i := -3; i <= 3; i++ {
+		for j := range 20 {
+			// across a tile edge on x, then on y
+			edge := float64(i) * e.step
+			along := float64(j)*0.37 - 3
+			for _, pair := range [2][2]Float2{
+				{{edge - nudge, along}, {edge + nudge, along}},
+				{{along, edge - nudge}, {along, edge + nudge}},
+			} {
+				before, after := e.delta(pair[0]), e.delta(pair[1])
+				if math.Abs(before-after) > 1e-4 {
+					t.Fatalf("erosion jumps from %v to %v across the tile edge at %v", before, after, pair[0])
+				}
+				moved = max(moved, math.Abs(before))
+			}
+		}
+	}
+	if moved == 0 {
+		t.Error("erosion didn't move any ground")
+	}
+}
+
+func TestErosionIsDeterministic(t *testing.T) {
+	a, _ := newTerrainGen(testErosionTerrain(1))
+	b, _ := newTerrainGen(testErosionTerrain(1))
+	other, _ := newTerrainGen(testErosionTerrain(2))
+	differs := false
+	for i := range 50 {
+		pos := Float2{float64(i)*0.73 - 18, float64(i%7)*1.9 - 6}
+		if a.elevation(pos) != b.elevation(pos) {
+			t.Fatalf("same seed gave different heights at %v", pos)
+		}
+		differs = differs || a.erosion.delta(pos) != other.erosion.delta(pos)
+	}
+	if !differs {
+		t.Error("a different seed eroded exactly the same")
+	}
+}
+
+func TestErodedChunksShareBorders(t *testing.T) {
+	config := testErosionTerrain(3)
+	c, err := NewChunker(ChunkerOptions{Synchronous: true, Resolution: 12, ChunkSize: 10, Terrain: &config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, right := c.chunkPoints([2]int{0, 0}, chunkDrawing{resolution: 12}), c.chunkPoints([2]int{1, 0}, chunkDrawing{resolution: 12})
+	for y := range left {
+		if left[y][len(left)-1] != right[y][0] {
+			t.Fatalf("chunks don't meet on row %v: %v and %v", y, left[y][len(left)-1], right[y][0])
+		}
+	}
+}
+
+func TestPlaceholdersDontErode(t *testing.T) {
+	config := testErosionTerrain(4)
+	c, err := NewChunker(ChunkerOptions{Resolution: 12, ChunkSize: 10, Terrain: &config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.terrainChunkLookup = newChunkCache()
+
+	// made on the render thread, so no tiles get eroded for it
+	_, drawing := c.placeholder(chunkKey{0, 0, 0})
+	c.drawn = map[[2]int]chunkDrawing{{0, 0}: drawing}
+	c.HeightAt(1, 12) // goes by the placeholder, so no eroding either
+	if tiles := len(c.gen.erosion.tiles); tiles != 0 {
+		t.Errorf("%v tiles eroded for a placeholder", tiles)
+	}
+}
+
+func TestErosionConfigValidate(t *testing.T) {
+	broken := map[string]func(*ErosionConfig){
+		"negative talus":    func(c *ErosionConfig) { c.TalusSlope = -1 },
+		"erode rate over 1": func(c *ErosionConfig) { c.ErodeRate = 2 },
+		"negative deposit":  func(c *ErosionConfig) { c.DepositRate = -0.1 },
+		"negative capacity": func(c *ErosionConfig) { c.Capacity = -1 },
+		"negative gravity":  func(c *ErosionConfig) { c.Gravity = -4 },
+		"nan inertia":       func(c *ErosionConfig) { c.Inertia = math.NaN() },
+		"zero cell size":    func(c *ErosionConfig) { c.CellSize = 0 },
+		"nan cell size":     func(c *ErosionConfig) { c.CellSize = math.NaN() },
+		"nan capacity":      func(c *ErosionConfig) { c.Capacity = math.NaN() },
+		"nan gravity":       func(c *ErosionConfig) { c.Gravity = math.NaN() },
+		"nan talus":         func(c *ErosionConfig) { c.TalusSlope = math.NaN() },
+	}
+	for name, breakIt := range broken {
+		config := DefaultErosionConfig()
+		breakIt(&config)
+		if config.validate() == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+	if err := DefaultErosionConfig().validate(); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+}
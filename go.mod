@@ -4,12 +4,12 @@ go 1.24.4
 
 require (
 	github.com/KEINOS/go-noise v0.1.0-rc1
+	github.com/ojrac/opensimplex-go v1.0.2
 	github.com/veandco/go-sdl2 v0.4.40
 	golang.org/x/image v0.28.0
 )
 
 require (
 	github.com/aquilax/go-perlin v1.1.0 // indirect
-	github.com/ojrac/opensimplex-go v1.0.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 )
@@ -0,0 +1,215 @@
+package raster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/bmp" // so grayscale bmps load too
+)
+
+// ------------ HEIGHTMAPS -------------
+
+// Heightmap is a grid of heights from 0 (black) to 1 (white), row by row.
+// row 0 is the top of the image, which ends up at the far (+z) side of the world
+type Heightmap struct {
+	Width, Height int
+	Heights       []float64
+
+	path string // where it was loaded from or saved to, for scene files
+}
+
+func NewHeightmap(width, height int) *Heightmap {
+	return &Heightmap{Width: width, Height: height, Heights: make([]float64, width*height)}
+}
+
+// At is the height of a pixel, anything off the edge gets the nearest edge pixel
+func (h *Heightmap) At(x, y int) float64 {
+	x, y = max(0, min(x, h.Width-1)), max(0, min(y, h.Height-1))
+	return h.Heights[y*h.Width+x]
+}
+
+func (h *Heightmap) Set(x, y int, height float64) {
+	h.Heights[y*h.Width+x] = height
+}
+
+// bilinear, x and y in pixels
+func (h *Heightmap) sample(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	top := h.At(ix, iy)*(1-fx) + h.At(ix+1, iy)*fx
+	bottom := h.At(ix, iy+1)*(1-fx) + h.At(ix+1, iy+1)*fx
+	return top*(1-fy) + bottom*fy
+}
+
+// ---- files
+
+// raw heightmaps are square, 16 bits per pixel, little endian, no header.
+// what most terrain tools write as .raw or .r16
+func isRaw(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".raw" || ext == ".r16"
+}
+
+// LoadHeightmap reads an 8 or 16 bit png (or bmp), or a raw 16 bit file.
+// color images are turned to gray
+func LoadHeightmap(path string) (*Heightmap, error) {
+	if isRaw(path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		side := int(math.Sqrt(float64(len(data) / 2)))
+		if side*side*2 != len(data) {
+			return nil, fmt.Errorf("%v: raw heightmap isn't square 16 bit", path)
+		}
+		h := NewHeightmap(side, side)
+		for i := range h.Heights {
+			h.Heights[i] = float64(binary.LittleEndian.Uint16(data[i*2:])) / math.MaxUint16
+		}
+		h.path = path
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	bounds := img.Bounds()
+	h := NewHeightmap(bounds.Dx(), bounds.Dy())
+	for y := range h.Height {
+		for x := range h.Width {
+			gray := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			h.Set(x, y, float64(gray.Y)/math.MaxUint16)
+		}
+	}
+	h.path = path
+	return h, nil
+}
+
+// Save writes a 16 bit grayscale png, or a raw file for .raw and .r16 (square maps only)
+func (h *Heightmap) Save(path string) error {
+	toUint16 := func(v float64) uint16 {
+		return uint16(math.Round(max(0, min(v, 1)) * math.MaxUint16))
+	}
+
+	var data []byte
+	switch {
+	case isRaw(path):
+		if h.Width != h.Height {
+			return errors.New("raw heightmaps have to be square")
+		}
+		data = make([]byte, len(h.Heights)*2)
+		for i, v := range h.Heights {
+			binary.LittleEndian.PutUint16(data[i*2:], toUint16(v))
+		}
+	case strings.EqualFold(filepath.Ext(path), ".png"):
+		img := image.NewGray16(image.Rect(0, 0, h.Width, h.Height))
+		for y := range h.Height {
+			for x := range h.Width {
+				img.SetGray16(x, y, color.Gray16{toUint16(h.At(x, y))})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("can't save heightmaps as %q, use .png, .raw or .r16", filepath.Ext(path))
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	h.path = path
+	return nil
+}
+
+// ---- terrain
+
+// HeightmapTerrain lays a heightmap out in the world, see TerrainConfig.Heightmap.
+// past the edges of the map the edge heights carry on
+type HeightmapTerrain struct {
+	Map      *Heightmap
+	CellSize float64 // world units between pixels
+	Min, Max float64 // world heights black and white turn into
+	Center   Float2  // world x and z the middle of the map sits on
+}
+
+func (t HeightmapTerrain) validate() error {
+	switch {
+	case t.Map == nil || t.Map.Width < 1 || t.Map.Height < 1:
+		return errors.New("heightmap terrain needs a map")
+	case len(t.Map.Heights) != t.Map.Width*t.Map.Height:
+		return errors.New("heightmap size doesn't match its heights")
+	case t.CellSize <= 0:
+		return errors.New("heightmap cell size has to be positive")
+	}
+	return nil
+}
+
+// height at a world position
+func (t HeightmapTerrain) height(x, z float64) float64 {
+	px := (x-t.Center.X)/t.CellSize + float64(t.Map.Width-1)/2
+	py := float64(t.Map.Height-1)/2 - (z-t.Center.Y)/t.CellSize
+	return t.Min + t.Map.sample(px, py)*(t.Max-t.Min)
+}
+
+// ExportHeightmap samples the full resolution terrain over a square of the world,
+// size across and centered on center (world x and z), into a pixels by pixels
+// heightmap and saves it to path (see Heightmap.Save). heights are stretched to
+// fill 0 to 1, Min and Max say what they were.
+//
+// the result can go into TerrainConfig.Heightmap to get roughly the same ground
+// back, not exactly: the map is smoothed between pixels, and the grid points
+// still get jiggled on the way in, so they land between the exported samples.
+// turn JiggleStrength off on both sides and use more pixels than the chunk grid
+// has points to get closest.
+//
+// an empty path skips saving, the map then has to be saved with Map.Save
+// before a scene using it can be saved
+func (c *Chunker) ExportHeightmap(path string, center Float2, size float64, pixels int) (HeightmapTerrain, error) {
+	pixels = max(pixels, 2)
+	cellSize := size / float64(pixels-1)
+	h := NewHeightmap(pixels, pixels)
+	low, high := math.Inf(1), math.Inf(-1)
+	for y := range pixels {
+		for x := range pixels {
+			worldX := center.X + (float64(x)-float64(pixels-1)/2)*cellSize
+			worldZ := center.Y - (float64(y)-float64(pixels-1)/2)*cellSize
+			height := c.heightAt(worldX, worldZ, true)
+			h.Set(x, y, height)
+			low, high = min(low, height), max(high, height)
+		}
+	}
+	if high == low { // flat, anything works as long as it's not dividing by 0
+		high = low + 1
+	}
+	for i, height := range h.Heights {
+		h.Heights[i] = (height - low) / (high - low)
+	}
+
+	terrain := HeightmapTerrain{Map: h, CellSize: cellSize, Min: low, Max: high, Center: center}
+	if path != "" {
+		if err := h.Save(path); err != nil {
+			return terrain, err
+		}
+	}
+	return terrain, nil
+}
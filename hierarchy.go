@@ -0,0 +1,117 @@
+package raster
+
+import "errors"
+
+// ------------ SCENE GRAPH -------------
+
+// models double as scene graph nodes. a model's Transform is relative to its
+// parent, and a model with no mesh works as an empty pivot.
+
+// empty model that only exists to group and move its children
+func NewNode(id string) *Model {
+	node := &Model{ID: id, Transform: Transform{Scale: Float3{1, 1, 1}}, Mesh: &Mesh{}}
+	node.Transform.UpdateBases()
+	return node
+}
+
+// the local transform as an Affine
+func (t Transform) Affine() Affine {
+	ihat, jhat, khat := t.GetBasisVectors()
+	return Affine{ihat.mulscal(t.Scale.X), jhat.mulscal(t.Scale.Y), khat.mulscal(t.Scale.Z), t.Position}
+}
+
+func (m *Model) Parent() *Model {
+	return m.parent
+}
+
+func (m *Model) Children() []*Model {
+	return m.children
+}
+
+// is m the same as, or somewhere below, other
+func (m *Model) isDescendantOf(other *Model) bool {
+	for node := m; node != nil; node = node.parent {
+		if node == other {
+			return true
+		}
+	}
+	return false
+}
+
+// SetParent moves the model under parent, keeping its local transform. nil
+// makes it a root again.
+func (m *Model) SetParent(parent *Model) error {
+	if parent != nil && parent.isDescendantOf(m) {
+		return errors.New("can't parent a model to itself or one of its children")
+	}
+
+	if m.parent != nil {
+		siblings := m.parent.children
+		if i := indexOf(siblings, m); i >= 0 {
+			m.parent.children = append(siblings[:i], siblings[i+1:]...)
+		}
+	}
+
+	m.parent = parent
+	if parent != nil {
+		parent.children = append(parent.children, m)
+	}
+	return nil
+}
+
+func (m *Model) AddChild(child *Model) error {
+	return child.SetParent(m)
+}
+
+// WorldTransform works out where the model is in world space by walking up its parents
+func (m *Model) WorldTransform() Affine {
+	world := m.Transform.Affine()
+	for node := m.parent; node != nil; node = node.parent {
+		world = node.Transform.Affine().Mul(world)
+	}
+	return world
+}
+
+// refresh the cached world transforms of a whole subtree, top down
+func (m *Model) updateWorld(parentWorld Affine) {
+	m.world = parentWorld.Mul(m.Transform.Affine())
+	for _, child := range m.children {
+		child.updateWorld(m.world)
+	}
+}
+
+// every model in the scene's trees, parents before their children. children
+// don't have to be added to the scene themselves to be in there
+func (s *Scene) eachModel(fn func(model *Model)) {
+	var walk func(model *Model)
+	walk = func(model *Model) {
+		fn(model)
+		for _, child := range model.children {
+			walk(child)
+		}
+	}
+	for _, model := range s.order {
+		if model.parent == nil {
+			walk(model)
+		}
+	}
+}
+
+// AttachTo makes the camera follow a model, its own transform then being
+// relative to the model. nil detaches it.
+func (c *Camera) AttachTo(m *Model) {
+	c.parent = m
+}
+
+func (c *Camera) Parent() *Model {
+	return c.parent
+}
+
+// where the camera sits in world space. scale is dropped so a scaled parent doesn't squash the view
+func (c Camera) worldTransform() Affine {
+	world := c.Transform.Affine()
+	if c.parent != nil {
+		world = c.parent.WorldTransform().Mul(world)
+	}
+	return world.withoutScale()
+}
@@ -0,0 +1,33 @@
+package raster
+
+// ------------ INSTANCING -------------
+
+// a model with Instances is drawn once per instance instead of once on its
+// own, all sharing the one mesh. good for forests, rock fields and the like.
+type Instance struct {
+	Transform Transform // relative to the model
+	Tint      Float3    // multiplies the shader's color. zero leaves it alone
+}
+
+// NewInstance makes an untinted, unrotated instance at a position relative to the model
+func NewInstance(position Float3) Instance {
+	inst := Instance{Transform: Transform{Position: position, Scale: Float3{1, 1, 1}}}
+	inst.Transform.UpdateBases()
+	return inst
+}
+
+func (m *Model) AddInstance(inst Instance) {
+	m.Instances = append(m.Instances, inst)
+}
+
+// call fn with the world transform of every copy of the model that gets drawn.
+// instance is -1 for a model that isn't instanced
+func (m *Model) eachInstance(world Affine, fn func(world Affine, instance int, tint Float3)) {
+	if len(m.Instances) == 0 {
+		fn(world, -1, Float3{})
+		return
+	}
+	for i, inst := range m.Instances {
+		fn(world.Mul(inst.Transform.Affine()), i, inst.Tint)
+	}
+}
@@ -0,0 +1,135 @@
+package raster
+
+import (
+	"math"
+	"slices"
+)
+
+// ------------ RENDER LAYERS -------------
+
+// layers are drawn in increasing order. the zero value is LayerOpaque
+type RenderLayer int
+
+const (
+	LayerBackground  RenderLayer = -1 // skyboxes and the like, drawn first
+	LayerOpaque      RenderLayer = 0
+	LayerTransparent RenderLayer = 1 // drawn back to front after everything opaque
+	LayerOverlay     RenderLayer = 2 // hud-like 3d bits, drawn last
+)
+
+// how the models in a layer are drawn
+type LayerSettings struct {
+	ClearDepth   bool // start with an empty depth buffer, so the layer lands on top of everything before it
+	NoDepthTest  bool // ignore depth completely and just draw in order
+	NoDepthWrite bool // don't let the layer hide what comes after it
+}
+
+func defaultLayerSettings() map[RenderLayer]LayerSettings {
+	return map[RenderLayer]LayerSettings{
+		LayerTransparent: {NoDepthWrite: true},
+		LayerOverlay:     {ClearDepth: true},
+	}
+}
+
+// rasterizer flags for a single draw
+type drawState struct {
+	depthTest  bool
+	depthWrite bool
+	near, far  float64 // from the camera, see render
+	linear     bool    // interpolate without perspective correction
+
+	tint Float3 // zero for none
+
+	// what's being drawn, for the id buffer
+	id       string
+	face     int
+	instance int
+}
+
+func (l LayerSettings) drawState() drawState {
+	return drawState{depthTest: !l.NoDepthTest, depthWrite: !l.NoDepthWrite}
+}
+
+// a model queued up for drawing this frame
+type drawItem struct {
+	model    Model // copy with the lod and world transform already picked
+	layer    RenderLayer
+	key      int
+	depth    float64 // view space depth of the model's center
+	instance int     // which of the model's instances, -1 if it isn't instanced
+	tint     Float3
+}
+
+// gather every visible model in the tree, world transforms must be up to date
+func queueTree(queue []drawItem, model *Model, cam Camera, view frustum, numPixels Float2) []drawItem {
+	if model.Hidden {
+		return queue
+	}
+	model.dropStaleLODs()
+	model.eachInstance(model.world, func(world Affine, instance int, tint Float3) {
+		item := drawItem{model: *model, layer: model.Layer, key: model.SortKey, instance: instance, tint: tint}
+		item.model.world = world
+		item.model.Mesh = item.model.selectLOD(cam, numPixels)
+		if item.model.Mesh.NumTriangles() == 0 { // empty nodes have nothing to draw or cull
+			return
+		}
+		if view.culls(item.model.Mesh, cam.view.Mul(world)) {
+			stats.ModelsCulled++
+			return
+		}
+		item.depth = cam.view.Apply(world.Apply(item.model.Mesh.bounds().Center)).Z
+		queue = append(queue, item)
+	})
+
+	// children can stick out of their parent, so they get checked either way
+	for _, child := range model.children {
+		queue = queueTree(queue, child, cam, view, numPixels)
+	}
+	return queue
+}
+
+// put the queue in drawing order. ties keep the order models were queued in
+func sortQueue(queue []drawItem) {
+	slices.SortStableFunc(queue, func(a, b drawItem) int {
+		if a.layer != b.layer {
+			return int(a.layer - b.layer)
+		}
+		if a.key != b.key {
+			return a.key - b.key
+		}
+		if a.layer == LayerTransparent && a.depth != b.depth {
+			if a.depth > b.depth { // far first
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+}
+
+func (s Scene) layerSettings(layer RenderLayer) LayerSettings {
+	if settings, ok := s.Layers[layer]; ok {
+		return settings
+	}
+	return LayerSettings{}
+}
+
+// draw the sorted queue, applying each layer's settings as it's reached
+func drawQueue(s Scene, img Image, queue []drawItem, cam Camera) Image {
+	layer := RenderLayer(math.MinInt)
+	var state drawState
+	for _, item := range queue {
+		if item.layer != layer {
+			layer = item.layer
+			settings := s.layerSettings(layer)
+			if settings.ClearDepth {
+				img.filldb()
+			}
+			state = settings.drawState()
+		}
+		state.instance, state.tint = item.instance, item.tint
+		img = render(img, item.model, cam, state)
+		stats.Triangles += item.model.getMesh().NumTriangles()
+	}
+	return img
+}
@@ -33,6 +33,10 @@ func (v Float2) mulscal(scalar float64) Float2 {
 	return Float2{v.X * scalar, v.Y * scalar}
 }
 
+func (v Float2) magnitude() float64 {
+	return math.Sqrt(v.X*v.X + v.Y*v.Y)
+}
+
 func (v Float3) add(other Float3) Float3 {
 	return Float3{v.X + other.X, v.Y + other.Y, v.Z + other.Z}
 }
@@ -160,3 +164,59 @@ func signedTriangleArea(a, b, c Float2) float64 {
 func ToRadians(d float64) float64 {
 	return d * math.Pi / 180
 }
+
+// Affine is a transform stored as where it sends the basis vectors, plus a
+// translation. unlike Transform these can be combined, which the scene graph needs.
+type Affine struct {
+	Ihat, Jhat, Khat Float3
+	Origin           Float3
+}
+
+func IdentityAffine() Affine {
+	return Affine{Float3{1, 0, 0}, Float3{0, 1, 0}, Float3{0, 0, 1}, Float3{}}
+}
+
+// transform a point
+func (a Affine) Apply(p Float3) Float3 {
+	return transformVector(a.Ihat, a.Jhat, a.Khat, p).add(a.Origin)
+}
+
+// transform a direction, ignoring the translation
+func (a Affine) ApplyVector(v Float3) Float3 {
+	return transformVector(a.Ihat, a.Jhat, a.Khat, v)
+}
+
+// a.Mul(b) applies b first, then a
+func (a Affine) Mul(b Affine) Affine {
+	return Affine{a.ApplyVector(b.Ihat), a.ApplyVector(b.Jhat), a.ApplyVector(b.Khat), a.Apply(b.Origin)}
+}
+
+func (a Affine) Inverse() Affine {
+	// rows of the inverse are the cross products of the columns over the determinant
+	r0 := cross3(a.Jhat, a.Khat)
+	r1 := cross3(a.Khat, a.Ihat)
+	r2 := cross3(a.Ihat, a.Jhat)
+	det := dot3(a.Ihat, r0)
+	if det == 0 {
+		return IdentityAffine()
+	}
+	r0, r1, r2 = r0.mulscal(1/det), r1.mulscal(1/det), r2.mulscal(1/det)
+
+	inv := Affine{
+		Ihat: Float3{r0.X, r1.X, r2.X},
+		Jhat: Float3{r0.Y, r1.Y, r2.Y},
+		Khat: Float3{r0.Z, r1.Z, r2.Z},
+	}
+	inv.Origin = inv.ApplyVector(a.Origin).mulscal(-1)
+	return inv
+}
+
+// same rotation and translation, with any scale taken out
+func (a Affine) withoutScale() Affine {
+	return Affine{a.Ihat.normalized(), a.Jhat.normalized(), a.Khat.normalized(), a.Origin}
+}
+
+// largest factor this stretches anything by, give or take shear
+func (a Affine) maxScale() float64 {
+	return max(a.Ihat.magnitude(), a.Jhat.magnitude(), a.Khat.magnitude())
+}
@@ -0,0 +1,140 @@
+package raster
+
+import "log"
+
+// ------------ MESH -------------
+
+// Mesh is an indexed triangle mesh. every vertex is a unique combination of
+// position, texture coordinate and normal, and Indices lists the triangles
+// as triples into those streams.
+type Mesh struct {
+	Positions []Float3
+	TexCoords []Float2
+	Normals   []Float3
+	Indices   []int
+
+	// optional, see GenerateTangents
+	Tangents   []Float3
+	Bitangents []Float3
+
+	screen []Float3 // scratch space for the per-frame transformed vertices
+
+	// cached derived data, cleared by Invalidate
+	sphere *BoundingSphere
+	box    *AABB
+	bvh    *bvh
+	edits  int // counts Invalidate calls, so lods can tell they were built from older geometry
+}
+
+// key used to find vertices that can be shared
+type meshVertex struct {
+	position Float3
+	texCoord Float2
+	normal   Float3
+}
+
+func (m *Mesh) appendVertex(position Float3, texCoord Float2, normal Float3) int {
+	m.Positions = append(m.Positions, position)
+	m.TexCoords = append(m.TexCoords, texCoord)
+	m.Normals = append(m.Normals, normal)
+	return len(m.Positions) - 1
+}
+
+func (m *Mesh) addTriangle(a, b, c int) {
+	m.Indices = append(m.Indices, a, b, c)
+}
+
+func (m *Mesh) NumVertices() int {
+	return len(m.Positions)
+}
+
+func (m *Mesh) NumTriangles() int {
+	return len(m.Indices) / 3
+}
+
+// drop cached data derived from the vertices. call it after editing the streams by hand
+func (m *Mesh) Invalidate() {
+	m.sphere = nil
+	m.box = nil
+	m.bvh = nil
+	m.edits++
+}
+
+// cached bounding sphere
+func (m *Mesh) bounds() BoundingSphere {
+	if m.sphere == nil {
+		sphere := m.BoundingSphere()
+		m.sphere = &sphere
+	}
+	return *m.sphere
+}
+
+// cached bounding box
+func (m *Mesh) boundingBox() AABB {
+	if m.box == nil {
+		box := m.BoundingBox()
+		m.box = &box
+	}
+	return *m.box
+}
+
+// build an indexed mesh out of polygon faces, sharing identical vertices.
+// badFaces is how many had to be triangulated as fans
+func newMeshFromFaces(faces []Face) (mesh *Mesh, badFaces int) {
+	mesh = &Mesh{}
+	lookup := make(map[meshVertex]int)
+
+	for _, face := range faces {
+		vertices, texCoords, normals, ok := face.convertToTriangles()
+		if !ok {
+			badFaces++
+		}
+		for i := range vertices {
+			key := meshVertex{vertices[i], texCoords[i], normals[i]}
+			index, ok := lookup[key]
+			if !ok {
+				index = mesh.appendVertex(key.position, key.texCoord, key.normal)
+				lookup[key] = index
+			}
+			mesh.Indices = append(mesh.Indices, index)
+		}
+	}
+
+	return mesh, badFaces
+}
+
+// (re)build the render mesh of a model from its faces
+func (m *Model) BuildMesh() {
+	mesh, badFaces := newMeshFromFaces(m.Faces)
+	if badFaces > 0 {
+		log.Printf("%v: %d degenerate or self-intersecting faces were triangulated as fans", m.ID, badFaces)
+	}
+	m.Mesh = mesh
+}
+
+// build the mesh from faces that came from an obj file or a primitive generator,
+// remembering which so scene files can point back at it
+func (m *Model) buildFromSource(asset string, primitive *primitiveFile) {
+	m.asset, m.primitive = asset, primitive
+	m.BuildMesh()
+	m.sourceMesh, m.sourceEdits = m.Mesh, m.Mesh.edits
+}
+
+// where the geometry came from, nothing once the mesh has been replaced
+// (subdividing, BuildMesh) or edited (Weld, Center and so on call Invalidate)
+func (m *Model) geometrySource() (asset string, primitive *primitiveFile) {
+	if m.Mesh == nil || m.Mesh != m.sourceMesh || m.Mesh.edits != m.sourceEdits {
+		return "", nil
+	}
+	return m.asset, m.primitive
+}
+
+// get the mesh to render, building a throwaway one if the model never had it built.
+// the warnings about bad faces come from BuildMesh, not from here every frame
+func (m Model) getMesh() *Mesh {
+	if m.Mesh != nil {
+		return m.Mesh
+	}
+	mesh, _ := newMeshFromFaces(m.Faces)
+	return mesh
+}
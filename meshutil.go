@@ -0,0 +1,246 @@
+package raster
+
+import "math"
+
+// ------------ MESH UTILS -------------
+
+// axis aligned bounding box
+type AABB struct {
+	Min, Max Float3
+}
+
+func (b AABB) Center() Float3 {
+	return b.Min.add(b.Max).mulscal(0.5)
+}
+
+func (b AABB) Size() Float3 {
+	return b.Max.sub(b.Min)
+}
+
+type BoundingSphere struct {
+	Center Float3
+	Radius float64
+}
+
+// normal of triangle abc, pointing out of the counter clockwise side
+func triangleNormal(a, b, c Float3) Float3 {
+	return cross3(b.sub(a), c.sub(b)).normalized()
+}
+
+// normal of a (possibly non planar) polygon using newell's method
+func polygonNormal(points []Float3) (normal Float3) {
+	for i := range points {
+		cur, next := points[i], points[(i+1)%len(points)]
+		normal.X += (cur.Y - next.Y) * (cur.Z + next.Z)
+		normal.Y += (cur.Z - next.Z) * (cur.X + next.X)
+		normal.Z += (cur.X - next.X) * (cur.Y + next.Y)
+	}
+	return normal.normalized()
+}
+
+func (m *Mesh) BoundingBox() (box AABB) {
+	if len(m.Positions) == 0 {
+		return
+	}
+	box.Min, box.Max = m.Positions[0], m.Positions[0]
+	for _, p := range m.Positions[1:] {
+		box.Min = Float3{min(box.Min.X, p.X), min(box.Min.Y, p.Y), min(box.Min.Z, p.Z)}
+		box.Max = Float3{max(box.Max.X, p.X), max(box.Max.Y, p.Y), max(box.Max.Z, p.Z)}
+	}
+	return
+}
+
+// sphere around the box center containing every vertex. not the tightest, but close enough
+func (m *Mesh) BoundingSphere() (sphere BoundingSphere) {
+	sphere.Center = m.BoundingBox().Center()
+	for _, p := range m.Positions {
+		sphere.Radius = max(sphere.Radius, p.sub(sphere.Center).magnitude())
+	}
+	return
+}
+
+// recompute the vertex normals. triangles meeting at a vertex are smoothed
+// together if their normals are within smoothAngle (radians) of each other,
+// so 0 gives flat shading and pi smooths everything.
+func (m *Mesh) RecomputeNormals(smoothAngle float64) {
+	numTris := m.NumTriangles()
+
+	// area weighted face normals
+	faceNormals := make([]Float3, numTris)
+	for t := range numTris {
+		a, b, c := m.Positions[m.Indices[t*3]], m.Positions[m.Indices[t*3+1]], m.Positions[m.Indices[t*3+2]]
+		faceNormals[t] = cross3(b.sub(a), c.sub(b))
+	}
+
+	// which triangles touch each position
+	trisAtPosition := make(map[Float3][]int)
+	for i, index := range m.Indices {
+		p := m.Positions[index]
+		trisAtPosition[p] = append(trisAtPosition[p], i/3)
+	}
+
+	cosThreshold := math.Cos(smoothAngle)
+	rebuilt := &Mesh{}
+	lookup := make(map[meshVertex]int)
+
+	for i, index := range m.Indices {
+		t := i / 3
+		p := m.Positions[index]
+
+		normal := faceNormals[t]
+		if smoothAngle > 0 {
+			normal = Float3{}
+			for _, other := range trisAtPosition[p] {
+				if dot3(faceNormals[t].normalized(), faceNormals[other].normalized()) >= cosThreshold {
+					normal = normal.add(faceNormals[other])
+				}
+			}
+		}
+
+		key := meshVertex{p, m.TexCoords[index], normal.normalized()}
+		newIndex, ok := lookup[key]
+		if !ok {
+			newIndex = rebuilt.appendVertex(key.position, key.texCoord, key.normal)
+			lookup[key] = newIndex
+		}
+		rebuilt.Indices = append(rebuilt.Indices, newIndex)
+	}
+
+	m.Positions, m.TexCoords, m.Normals, m.Indices = rebuilt.Positions, rebuilt.TexCoords, rebuilt.Normals, rebuilt.Indices
+	m.Tangents, m.Bitangents = nil, nil // vertices changed, these are stale now
+}
+
+// generate per vertex tangents and bitangents from the texture coordinates, for normal mapping
+func (m *Mesh) GenerateTangents() {
+	tangents := make([]Float3, len(m.Positions))
+	bitangents := make([]Float3, len(m.Positions))
+
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		i0, i1, i2 := m.Indices[i], m.Indices[i+1], m.Indices[i+2]
+		edge1 := m.Positions[i1].sub(m.Positions[i0])
+		edge2 := m.Positions[i2].sub(m.Positions[i0])
+		duv1 := m.TexCoords[i1].sub(m.TexCoords[i0])
+		duv2 := m.TexCoords[i2].sub(m.TexCoords[i0])
+
+		det := duv1.X*duv2.Y - duv2.X*duv1.Y
+		if math.Abs(det) < 1e-12 { // no usable uv mapping on this triangle
+			continue
+		}
+		r := 1 / det
+		tangent := edge1.mulscal(duv2.Y).sub(edge2.mulscal(duv1.Y)).mulscal(r)
+		bitangent := edge2.mulscal(duv1.X).sub(edge1.mulscal(duv2.X)).mulscal(r)
+
+		for _, index := range []int{i0, i1, i2} {
+			tangents[index] = tangents[index].add(tangent)
+			bitangents[index] = bitangents[index].add(bitangent)
+		}
+	}
+
+	// gram-schmidt against the normal, keeping the handedness of the uv mapping
+	for i, normal := range m.Normals {
+		t := tangents[i].sub(normal.mulscal(dot3(normal, tangents[i]))).normalized()
+		b := cross3(normal, t)
+		if dot3(b, bitangents[i]) < 0 {
+			b = b.mulscal(-1)
+		}
+		tangents[i], bitangents[i] = t, b
+	}
+
+	m.Tangents, m.Bitangents = tangents, bitangents
+}
+
+// merge vertices whose position, texture coordinate and normal are all within
+// epsilon of each other. triangles that collapse are dropped. returns the
+// number of vertices removed.
+func (m *Mesh) Weld(epsilon float64) int {
+	if epsilon <= 0 {
+		epsilon = 1e-9
+	}
+	cellOf := func(p Float3) [3]int64 {
+		return [3]int64{int64(math.Floor(p.X / epsilon)), int64(math.Floor(p.Y / epsilon)), int64(math.Floor(p.Z / epsilon))}
+	}
+	isClose := func(a, b int) bool {
+		return m.Positions[a].sub(m.Positions[b]).magnitude() <= epsilon &&
+			m.TexCoords[a].sub(m.TexCoords[b]).magnitude() <= epsilon &&
+			m.Normals[a].sub(m.Normals[b]).magnitude() <= epsilon
+	}
+
+	grid := make(map[[3]int64][]int) // cell -> kept vertices in it
+	remap := make([]int, len(m.Positions))
+	welded := &Mesh{}
+
+	for i, p := range m.Positions {
+		cell := cellOf(p)
+		remap[i] = -1
+
+		// search the neighbouring cells too, in case a match sits across a cell border
+	search:
+		for dz := int64(-1); dz <= 1; dz++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dx := int64(-1); dx <= 1; dx++ {
+					for _, kept := range grid[[3]int64{cell[0] + dx, cell[1] + dy, cell[2] + dz}] {
+						if isClose(i, kept) {
+							remap[i] = remap[kept]
+							break search
+						}
+					}
+				}
+			}
+		}
+
+		if remap[i] == -1 {
+			remap[i] = welded.appendVertex(p, m.TexCoords[i], m.Normals[i])
+			grid[cell] = append(grid[cell], i)
+		}
+	}
+
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		a, b, c := remap[m.Indices[i]], remap[m.Indices[i+1]], remap[m.Indices[i+2]]
+		if a == b || b == c || c == a {
+			continue
+		}
+		welded.addTriangle(a, b, c)
+	}
+
+	removed := len(m.Positions) - len(welded.Positions)
+	m.Positions, m.TexCoords, m.Normals, m.Indices = welded.Positions, welded.TexCoords, welded.Normals, welded.Indices
+	m.Tangents, m.Bitangents = nil, nil
+	m.Invalidate()
+	return removed
+}
+
+// reverse the winding order of every triangle and flip the normals to match
+func (m *Mesh) FlipWinding() {
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		m.Indices[i+1], m.Indices[i+2] = m.Indices[i+2], m.Indices[i+1]
+	}
+	for i := range m.Normals {
+		m.Normals[i] = m.Normals[i].mulscal(-1)
+	}
+	for i := range m.Bitangents {
+		m.Bitangents[i] = m.Bitangents[i].mulscal(-1)
+	}
+	m.Invalidate()
+}
+
+// move the mesh so its bounding box is centered on the origin
+func (m *Mesh) Center() {
+	center := m.BoundingBox().Center()
+	for i := range m.Positions {
+		m.Positions[i] = m.Positions[i].sub(center)
+	}
+	m.Invalidate()
+}
+
+// uniformly scale the mesh about the origin so its largest dimension is size
+func (m *Mesh) NormalizeScale(size float64) {
+	extent := m.BoundingBox().Size()
+	largest := max(extent.X, extent.Y, extent.Z)
+	if largest == 0 {
+		return
+	}
+	for i := range m.Positions {
+		m.Positions[i] = m.Positions[i].mulscal(size / largest)
+	}
+	m.Invalidate()
+}
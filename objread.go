@@ -29,28 +29,18 @@ func stringsToFloatSlice(parts []string) ([]float64, error) {
 	return floats, nil
 }
 
-// fucking go
-func stringsToIntSlice(parts []string) ([]int, error) {
-	ints := make([]int, 0, len(parts))
-
-	for _, s := range parts {
-		if s == "" {
-			continue
-		}
-		i, err := strconv.ParseInt(s, 0, 0)
-		if err != nil {
-			return nil, err
-		}
-		ints = append(ints, int(i))
-	}
-
-	return ints, nil
+func loadObjFile(path string) (faces []Face) {
+	faces, err := readObjFile(path)
+	Check(err)
+	return faces
 }
 
-func loadObjFile(path string) (faces []Face) {
+func readObjFile(path string) ([]Face, error) {
 	data, err := os.ReadFile(path)
-	Check(err)
-	return getObjData(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return getObjData(string(data)), nil
 }
 
 type Face struct {
@@ -59,26 +49,48 @@ type Face struct {
 	normals   []Float3
 }
 
-func (f Face) convertToTriangles() (vertices []Float3, vertexTexCoords []Float2, vertexNormals []Float3) {
+func (f Face) convertToTriangles() (vertices []Float3, vertexTexCoords []Float2, vertexNormals []Float3, ok bool) {
 	n := len(f.vertices)
 	if n < 3 {
 		panic("Not enough vertices in face for a triangle!")
 	}
 
-	vertices = make([]Float3, 0, f.getNumTriangles())
-	vertexTexCoords = make([]Float2, 0, f.getNumTriangles())
-	vertexNormals = make([]Float3, 0, f.getNumTriangles())
+	vertices = make([]Float3, 0, f.getNumTriangles()*3)
+	vertexTexCoords = make([]Float2, 0, f.getNumTriangles()*3)
+	vertexNormals = make([]Float3, 0, f.getNumTriangles()*3)
 
-	// triangle fan
-	for i := 1; i < n-1; i++ {
-		vertices = append(vertices, f.vertices[0], f.vertices[i], f.vertices[i+1])
-		vertexTexCoords = append(vertexTexCoords, f.texCoords[0], f.texCoords[i], f.texCoords[i+1])
-		vertexNormals = append(vertexNormals, f.normals[0], f.normals[i], f.normals[i+1])
+	triangles, ok := f.triangulate()
+	for _, tri := range triangles {
+		for _, i := range tri {
+			vertices = append(vertices, f.vertices[i])
+			vertexTexCoords = append(vertexTexCoords, f.texCoords[i])
+			vertexNormals = append(vertexNormals, f.normals[i])
+		}
 	}
 
 	return
 }
 
+// resolve a 1-based (or negative, relative) obj index into a slice index
+func objIndex(part string, count int) (int, bool) {
+	if part == "" {
+		return 0, false
+	}
+	i, err := strconv.Atoi(part)
+	if err != nil || i == 0 {
+		return 0, false
+	}
+	if i < 0 {
+		i = count + i
+	} else {
+		i--
+	}
+	if i < 0 || i >= count {
+		return 0, false
+	}
+	return i, true
+}
+
 // ugh
 func getObjData(objString string) (faces []Face) {
 	allVertices := make([]Float3, 0)      // geometry vertices
@@ -88,39 +100,81 @@ func getObjData(objString string) (faces []Face) {
 	faces = make([]Face, 0) // output faces (face index groups)
 
 	for line := range strings.SplitSeq(objString, "\n") {
-		if len(line) > 1 {
-			if line[:2] == "v " { // vertex positions
-				axes, _ := stringsToFloatSlice(strings.Split(line[2:], " "))
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v": // vertex positions
+			axes, _ := stringsToFloatSlice(fields[1:])
+			if len(axes) >= 3 {
 				allVertices = append(allVertices, Float3{axes[0], axes[1], axes[2]})
+			}
 
-			} else if line[:3] == "vt " { // texture data
-				tpoint, _ := stringsToFloatSlice(strings.Split(line[3:], " "))
-				allTexturePoints = append(allTexturePoints, Float2{tpoint[0], tpoint[1]})
+		case "vt": // texture data
+			tpoint, _ := stringsToFloatSlice(fields[1:])
+			tpoint = append(tpoint, 0, 0) // some exporters only write u
+			allTexturePoints = append(allTexturePoints, Float2{tpoint[0], tpoint[1]})
 
-			} else if line[:3] == "vn " { // normal data
-				tpoint, _ := stringsToFloatSlice(strings.Split(line[3:], " "))
+		case "vn": // normal data
+			tpoint, _ := stringsToFloatSlice(fields[1:])
+			if len(tpoint) >= 3 {
 				allNormalPoints = append(allNormalPoints, Float3{tpoint[0], tpoint[1], tpoint[2]})
+			}
 
-			} else if line[:2] == "f " { // face indices
-				faceIndexGroups := strings.Split(line[2:], " ")
+		case "f": // face indices
+			face := Face{
+				vertices:  make([]Float3, 0),
+				texCoords: make([]Float2, 0),
+				normals:   make([]Float3, 0),
+			}
+			missingNormals := false
+
+			// iterate over the groups, v, v/vt, v//vn or v/vt/vn
+			for _, group := range fields[1:] {
+				parts := strings.Split(group, "/")
 
-				face := Face{
-					vertices:  make([]Float3, 0),
-					texCoords: make([]Float2, 0),
-					normals:   make([]Float3, 0),
+				vi, ok := objIndex(parts[0], len(allVertices))
+				if !ok {
+					continue
 				}
+				face.vertices = append(face.vertices, allVertices[vi])
 
-				// iterate over the groups
-				for i := range faceIndexGroups {
-					indexGroup, _ := stringsToIntSlice(strings.Split(faceIndexGroups[i], "/"))
+				var texCoord Float2
+				if len(parts) > 1 {
+					if ti, ok := objIndex(parts[1], len(allTexturePoints)); ok {
+						texCoord = allTexturePoints[ti]
+					}
+				}
+				face.texCoords = append(face.texCoords, texCoord)
 
-					face.vertices = append(face.vertices, allVertices[indexGroup[0]-1])
-					face.texCoords = append(face.texCoords, allTexturePoints[indexGroup[1]-1])
-					face.normals = append(face.normals, allNormalPoints[indexGroup[2]-1])
+				var normal Float3
+				ni, ok := 0, false
+				if len(parts) > 2 {
+					ni, ok = objIndex(parts[2], len(allNormalPoints))
 				}
+				if ok {
+					normal = allNormalPoints[ni]
+				} else {
+					missingNormals = true
+				}
+				face.normals = append(face.normals, normal)
+			}
 
-				faces = append(faces, face)
+			if len(face.vertices) < 3 {
+				continue
 			}
+
+			// no normals in the file, so shade it flat
+			if missingNormals {
+				normal := polygonNormal(face.vertices)
+				for i := range face.normals {
+					face.normals[i] = normal
+				}
+			}
+
+			faces = append(faces, face)
 		}
 	}
 	return
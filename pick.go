@@ -0,0 +1,48 @@
+package raster
+
+// ------------ PICKING -------------
+
+// what got drawn into a pixel. only filled in for images with an id buffer
+type Pick struct {
+	ID       string // model or terrain chunk id
+	Face     int    // triangle index into the drawn mesh, which is a lod mesh if one was picked
+	Instance int    // index into the model's Instances, -1 if it isn't instanced
+	Depth    float64
+}
+
+// EnableIDBuffer makes rendering also record which model and triangle ended up
+// in each pixel, for Pick. costs a bit of memory and time, so it's off by default
+func (i *Image) EnableIDBuffer() {
+	if i.idBuffer != nil {
+		return
+	}
+	i.idBuffer = make([][]Pick, i.h)
+	for y := range i.idBuffer {
+		i.idBuffer[y] = make([]Pick, i.w)
+	}
+}
+
+func (i Image) HasIDBuffer() bool {
+	return i.idBuffer != nil
+}
+
+func (i *Image) clearIDs() {
+	for y := range i.idBuffer {
+		clear(i.idBuffer[y])
+	}
+}
+
+// Pick says what's in a pixel of the image, y going up. ok is false for
+// background, or if the image has no id buffer
+func (i Image) Pick(x, y int) (pick Pick, ok bool) {
+	if i.idBuffer == nil || x < 0 || y < 0 || x >= i.w || y >= i.h {
+		return
+	}
+	pick = i.idBuffer[y][x]
+	return pick, pick.ID != ""
+}
+
+// Pick says what's under a point in the window, like the mouse. needs IDBuffer on
+func (s *SoftwareRasterizer) Pick(windowX, windowY int) (Pick, bool) {
+	return s.MetaBuffer.Pick(windowX, s.MetaBuffer.h-1-windowY) // the window shows the image upside down
+}
@@ -0,0 +1,239 @@
+package raster
+
+import (
+	"math"
+	"slices"
+)
+
+// ------------ PRIMITIVES -------------
+
+// point on the outline that gets spun around the y axis
+type profilePoint struct {
+	radius, y float64
+	normal    Float2 // (outward, up) in the profile plane
+	v         float64
+}
+
+// reverse the face if its winding doesn't agree with its normals
+func orientFace(f *Face) {
+	var normal Float3
+	for _, n := range f.normals {
+		normal = normal.add(n)
+	}
+	if dot3(polygonNormal(f.vertices), normal) < 0 {
+		slices.Reverse(f.vertices)
+		slices.Reverse(f.texCoords)
+		slices.Reverse(f.normals)
+	}
+}
+
+// make a face from corners, dropping repeated corners (like the ones at a sphere's poles)
+func newPrimitiveFace(vertices []Float3, texCoords []Float2, normals []Float3) (Face, bool) {
+	same := func(a, b Float3) bool { return a.sub(b).magnitude() < 1e-9 }
+
+	var f Face
+	for i := range vertices {
+		if i > 0 && same(vertices[i], vertices[i-1]) || i == len(vertices)-1 && same(vertices[i], vertices[0]) {
+			continue
+		}
+		f.vertices = append(f.vertices, vertices[i])
+		f.texCoords = append(f.texCoords, texCoords[i])
+		f.normals = append(f.normals, normals[i])
+	}
+	if len(f.vertices) < 3 {
+		return f, false
+	}
+	orientFace(&f)
+	return f, true
+}
+
+// spin a profile around the y axis, making a ring of quads between each pair of profile points
+func revolveFaces(profile []profilePoint, segments int) (faces []Face) {
+	segments = max(segments, 3)
+	at := func(p profilePoint, s int) (Float3, Float2, Float3) {
+		angle := float64(s%segments) / float64(segments) * 2 * math.Pi // wrap so the seam welds exactly
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		radius := p.radius
+		if math.Abs(radius) < 1e-9 { // poles, sin(pi) isn't quite zero
+			radius = 0
+		}
+		position := Float3{radius * cos, p.y, radius * sin}
+		normal := Float3{p.normal.X * cos, p.normal.Y, p.normal.X * sin}.normalized()
+		return position, Float2{float64(s) / float64(segments), p.v}, normal
+	}
+
+	for i := 0; i+1 < len(profile); i++ {
+		for s := range segments {
+			var vertices [4]Float3
+			var texCoords [4]Float2
+			var normals [4]Float3
+			vertices[0], texCoords[0], normals[0] = at(profile[i], s)
+			vertices[1], texCoords[1], normals[1] = at(profile[i], s+1)
+			vertices[2], texCoords[2], normals[2] = at(profile[i+1], s+1)
+			vertices[3], texCoords[3], normals[3] = at(profile[i+1], s)
+			if face, ok := newPrimitiveFace(vertices[:], texCoords[:], normals[:]); ok {
+				faces = append(faces, face)
+			}
+		}
+	}
+	return
+}
+
+// flat disk facing up or down, as a single polygon
+func diskFace(radius, y float64, up bool, segments int) Face {
+	segments = max(segments, 3)
+	normal := Float3{0, 1, 0}
+	if !up {
+		normal = Float3{0, -1, 0}
+	}
+
+	var f Face
+	for s := range segments {
+		angle := float64(s) / float64(segments) * 2 * math.Pi
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		f.vertices = append(f.vertices, Float3{radius * cos, y, radius * sin})
+		f.texCoords = append(f.texCoords, Float2{0.5 + 0.5*cos, 0.5 + 0.5*sin})
+		f.normals = append(f.normals, normal)
+	}
+	orientFace(&f)
+	return f
+}
+
+// grid of quads on the plane origin + u*uAxis + v*vAxis, for u and v in [0, 1]
+func gridFaces(origin, uAxis, vAxis, normal Float3, uSegments, vSegments int) (faces []Face) {
+	uSegments, vSegments = max(uSegments, 1), max(vSegments, 1)
+	at := func(i, j int) (Float3, Float2) {
+		u, v := float64(i)/float64(uSegments), float64(j)/float64(vSegments)
+		return origin.add(uAxis.mulscal(u)).add(vAxis.mulscal(v)), Float2{u, v}
+	}
+
+	for j := range vSegments {
+		for i := range uSegments {
+			var vertices [4]Float3
+			var texCoords [4]Float2
+			vertices[0], texCoords[0] = at(i, j)
+			vertices[1], texCoords[1] = at(i+1, j)
+			vertices[2], texCoords[2] = at(i+1, j+1)
+			vertices[3], texCoords[3] = at(i, j+1)
+			if face, ok := newPrimitiveFace(vertices[:], texCoords[:], []Float3{normal, normal, normal, normal}); ok {
+				faces = append(faces, face)
+			}
+		}
+	}
+	return
+}
+
+func newPrimitiveModel(id string, faces []Face, spec primitiveFile) *Model {
+	model := &Model{
+		ID:        id,
+		Faces:     faces,
+		Transform: Transform{Scale: Float3{1, 1, 1}},
+	}
+	model.Transform.UpdateBases()
+	model.buildFromSource("", &spec)
+	return model
+}
+
+// axis aligned cube centered on the origin, each side split into segments x segments quads
+func NewCube(id string, size float64, segments int) *Model {
+	h := size / 2
+	sides := []struct{ origin, u, v, normal Float3 }{
+		{Float3{-h, -h, h}, Float3{size, 0, 0}, Float3{0, size, 0}, Float3{0, 0, 1}},   // front
+		{Float3{h, -h, -h}, Float3{-size, 0, 0}, Float3{0, size, 0}, Float3{0, 0, -1}}, // back
+		{Float3{h, -h, h}, Float3{0, 0, -size}, Float3{0, size, 0}, Float3{1, 0, 0}},   // right
+		{Float3{-h, -h, -h}, Float3{0, 0, size}, Float3{0, size, 0}, Float3{-1, 0, 0}}, // left
+		{Float3{-h, h, h}, Float3{size, 0, 0}, Float3{0, 0, -size}, Float3{0, 1, 0}},   // top
+		{Float3{-h, -h, -h}, Float3{size, 0, 0}, Float3{0, 0, size}, Float3{0, -1, 0}}, // bottom
+	}
+
+	faces := make([]Face, 0)
+	for _, side := range sides {
+		faces = append(faces, gridFaces(side.origin, side.u, side.v, side.normal, segments, segments)...)
+	}
+	return newPrimitiveModel(id, faces, primitiveFile{Type: "cube", Size: size, Segments: segments})
+}
+
+// flat plane on xz facing up, centered on the origin
+func NewPlane(id string, width, depth float64, xSegments, zSegments int) *Model {
+	origin := Float3{-width / 2, 0, -depth / 2}
+	faces := gridFaces(origin, Float3{width, 0, 0}, Float3{0, 0, depth}, Float3{0, 1, 0}, xSegments, zSegments)
+	return newPrimitiveModel(id, faces, primitiveFile{Type: "plane", Width: width, Depth: depth, Segments: xSegments, Rings: zSegments})
+}
+
+// uv sphere centered on the origin
+func NewSphere(id string, radius float64, segments, rings int) *Model {
+	rings = max(rings, 2)
+	profile := make([]profilePoint, 0, rings+1)
+	for i := range rings + 1 {
+		theta := float64(i) / float64(rings) * math.Pi
+		out, up := math.Sin(theta), -math.Cos(theta) // from the bottom pole up
+		profile = append(profile, profilePoint{radius * out, radius * up, Float2{out, up}, float64(i) / float64(rings)})
+	}
+	return newPrimitiveModel(id, revolveFaces(profile, segments), primitiveFile{Type: "sphere", Radius: radius, Segments: segments, Rings: rings})
+}
+
+// capped cylinder standing on the y axis, centered on the origin
+func NewCylinder(id string, radius, height float64, segments int) *Model {
+	profile := []profilePoint{
+		{radius, -height / 2, Float2{1, 0}, 0},
+		{radius, height / 2, Float2{1, 0}, 1},
+	}
+	faces := revolveFaces(profile, segments)
+	faces = append(faces, diskFace(radius, height/2, true, segments), diskFace(radius, -height/2, false, segments))
+	return newPrimitiveModel(id, faces, primitiveFile{Type: "cylinder", Radius: radius, Height: height, Segments: segments})
+}
+
+// cone with its base on the bottom and tip on top, centered on the origin
+func NewCone(id string, radius, height float64, segments int) *Model {
+	slant := Float2{height, radius}.mulscal(1 / math.Hypot(height, radius))
+	profile := []profilePoint{
+		{radius, -height / 2, slant, 0},
+		{0, height / 2, slant, 1},
+	}
+	faces := revolveFaces(profile, segments)
+	faces = append(faces, diskFace(radius, -height/2, false, segments))
+	return newPrimitiveModel(id, faces, primitiveFile{Type: "cone", Radius: radius, Height: height, Segments: segments})
+}
+
+// torus lying flat on xz. majorRadius goes to the center of the tube, minorRadius is the tube itself
+func NewTorus(id string, majorRadius, minorRadius float64, majorSegments, minorSegments int) *Model {
+	minorSegments = max(minorSegments, 3)
+	profile := make([]profilePoint, 0, minorSegments+1)
+	for i := range minorSegments + 1 {
+		angle := float64(i) / float64(minorSegments) * 2 * math.Pi
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		profile = append(profile, profilePoint{majorRadius + minorRadius*cos, minorRadius * sin, Float2{cos, sin}, float64(i) / float64(minorSegments)})
+	}
+	return newPrimitiveModel(id, revolveFaces(profile, majorSegments), primitiveFile{Type: "torus", Radius: majorRadius, MinorRadius: minorRadius, Segments: majorSegments, Rings: minorSegments})
+}
+
+// capsule standing on the y axis. height is the full height including both caps
+func NewCapsule(id string, radius, height float64, segments, rings int) *Model {
+	rings = max(rings, 1) // per hemisphere
+	half := max(height/2-radius, 0)
+	profile := make([]profilePoint, 0, 2*rings+2)
+
+	// bottom cap, then the top cap. the jump between them is the cylinder
+	for i := range rings + 1 {
+		theta := float64(i) / float64(rings) * math.Pi / 2
+		out, up := math.Sin(theta), -math.Cos(theta)
+		profile = append(profile, profilePoint{radius * out, radius*up - half, Float2{out, up}, 0})
+	}
+	for i := range rings + 1 {
+		theta := math.Pi/2 + float64(i)/float64(rings)*math.Pi/2
+		out, up := math.Sin(theta), -math.Cos(theta)
+		profile = append(profile, profilePoint{radius * out, radius*up + half, Float2{out, up}, 0})
+	}
+
+	// texture v runs along the whole outline
+	total := radius*math.Pi + 2*half
+	for i := range profile {
+		if i > rings {
+			profile[i].v = (radius*math.Pi/2 + 2*half + (float64(i-rings-1)/float64(rings))*radius*math.Pi/2) / total
+		} else {
+			profile[i].v = (float64(i) / float64(rings)) * radius * math.Pi / 2 / total
+		}
+	}
+
+	return newPrimitiveModel(id, revolveFaces(profile, segments), primitiveFile{Type: "capsule", Radius: radius, Height: height, Segments: segments, Rings: rings})
+}
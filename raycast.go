@@ -0,0 +1,85 @@
+package raster
+
+import "math"
+
+// ------------ RAYCASTING -------------
+
+type RayHit struct {
+	Model       *Model // nil when the ray hit terrain
+	ID          string // model or terrain chunk id
+	Face        int    // triangle index into the mesh's Indices
+	Instance    int    // index into the model's Instances, -1 if it isn't instanced
+	Barycentric Float3 // weights of the triangle's three corners at the hit
+	Distance    float64
+	Position    Float3 // world space
+	Normal      Float3 // interpolated vertex normal, world space
+}
+
+// Raycast finds the first thing a ray hits, checking every visible model (children
+// included) and the active terrain chunks. triangles count from both sides. models
+// are checked against their full detail mesh, not whatever lod was last drawn.
+func (s *Scene) Raycast(origin, dir Float3) (hit RayHit, ok bool) {
+	dir = dir.normalized()
+	if dir == (Float3{}) {
+		return
+	}
+	hit.Distance = math.Inf(1)
+
+	// check one model, keeping the hit if it's the closest so far
+	try := func(model *Model, world Affine, instance int) bool {
+		mesh := model.Mesh
+		if mesh == nil || mesh.NumTriangles() == 0 {
+			return false
+		}
+
+		// skip the whole model if the ray misses its bounding sphere
+		sphere := mesh.bounds()
+		center := world.Apply(sphere.Center)
+		radius := sphere.Radius * world.maxScale()
+		along := dot3(center.sub(origin), dir)
+		closest := origin.add(dir.mulscal(along)).sub(center).magnitude()
+		if closest > radius || along+radius < 0 || along-radius > hit.Distance {
+			return false
+		}
+
+		// into model space. dir isn't renormalized, so distances stay the same
+		toLocal := world.Inverse()
+		face, t, weights, found := mesh.raycast(toLocal.Apply(origin), toLocal.ApplyVector(dir), hit.Distance)
+		if !found {
+			return false
+		}
+
+		ok = true
+		hit = RayHit{Model: model, ID: model.ID, Face: face, Instance: instance, Barycentric: weights, Distance: t}
+		hit.Position = origin.add(dir.mulscal(t))
+		corners := mesh.Indices[face*3 : face*3+3]
+		normal := mesh.Normals[corners[0]].mulscal(weights.X).
+			add(mesh.Normals[corners[1]].mulscal(weights.Y)).
+			add(mesh.Normals[corners[2]].mulscal(weights.Z))
+		// normals go through the inverse transpose, so squashed models still get the right ones
+		hit.Normal = Float3{dot3(toLocal.Ihat, normal), dot3(toLocal.Jhat, normal), dot3(toLocal.Khat, normal)}.normalized()
+		return true
+	}
+
+	s.eachModel(func(model *Model) {
+		if model.visible() {
+			// models only loaded as faces get their mesh built once and kept, so its
+			// bvh is kept too instead of being rebuilt for every ray
+			if model.Mesh == nil && len(model.Faces) > 0 {
+				model.BuildMesh()
+			}
+			model.eachInstance(model.WorldTransform(), func(world Affine, instance int, _ Float3) {
+				try(model, world, instance)
+			})
+		}
+	})
+	if s.Chunker != nil {
+		for i := range s.Chunker.terrainChunksActive {
+			chunk := s.Chunker.terrainChunksActive[i]
+			if try(&chunk, chunk.Transform.Affine(), -1) {
+				hit.Model = nil // the chunk is a copy, no use to anyone
+			}
+		}
+	}
+	return
+}
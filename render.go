@@ -7,93 +7,118 @@ import (
 
 // -------------------------- render
 
-type Camera struct {
-	fov       float64
-	transform Transform
+func vertexToScreen(vertex Float3, world Affine, cam Camera, numPixels Float2) Float3 {
+	vertex_world := world.Apply(vertex)
+	vertex_view := cam.view.Apply(vertex_world)
+	return cam.project(vertex_view, numPixels)
 }
 
-func vertexToScreen(vertex Float3, transform Transform, cam Camera, numPixels Float2) Float3 {
-	vertex_world := transform.toWorldPoint(vertex)
-	vertex_view := cam.transform.toLocalPoint(vertex_world)
-	depth := vertex_view.Z
+func render(img Image, model Model, cam Camera, state drawState) Image {
+	mesh := model.getMesh()
+	if mesh.NumTriangles() == 0 { // nothing to draw, like an empty node
+		return img
+	}
+	if model.Shader == nil {
+		panic(fmt.Sprintf("No shader selected on model %v!", model.ID))
+	}
 
-	var screenHeight_World float64 = math.Tan(cam.fov / 2)
-	pixelsPerWorldUnit := numPixels.Y / screenHeight_World / depth
+	// transform every unique vertex once
+	if cap(mesh.screen) < len(mesh.Positions) {
+		mesh.screen = make([]Float3, len(mesh.Positions))
+	}
+	screen := mesh.screen[:len(mesh.Positions)]
+	for i, vertex := range mesh.Positions {
+		screen[i] = vertexToScreen(vertex, model.world, cam, img.fs())
+	}
+	state.near, state.far = cam.Near, cam.Far
+	state.linear = cam.Projection == Orthographic
+	state.id = model.ID
+
+	for i := 0; i+2 < len(mesh.Indices); i += 3 {
+		i0, i1, i2 := mesh.Indices[i+0], mesh.Indices[i+1], mesh.Indices[i+2]
+		state.face = i / 3
+		rasterizeTriangle(img,
+			[3]Float3{screen[i0], screen[i1], screen[i2]},
+			[3]Float2{mesh.TexCoords[i0], mesh.TexCoords[i1], mesh.TexCoords[i2]},
+			[3]Float3{mesh.Normals[i0], mesh.Normals[i1], mesh.Normals[i2]},
+			model.Shader,
+			state,
+		)
+	}
 
-	pixelOffset := Float2{vertex_view.X * pixelsPerWorldUnit, vertex_view.Y * pixelsPerWorldUnit}
-	vertex_screen := pixelOffset.add(Float2{numPixels.X / 2, numPixels.Y / 2})
-	return Float3{vertex_screen.X, vertex_screen.Y, vertex_view.Z}
+	return img
 }
 
-func render(img Image, model Model, cam Camera) Image {
+// draw a single screen space triangle into the image
+func rasterizeTriangle(img Image, verts [3]Float3, texCoords [3]Float2, normals [3]Float3, shader Shader, state drawState) {
+	a, b, c := verts[0], verts[1], verts[2]
 
-	for _, face := range model.Faces {
-		triangleVertices, vertexTexCoords, vertexNormals := face.convertToTriangles()
-		for i := 0; i < len(triangleVertices); i += 3 {
-			// println(model.faceCount, curFace, model.vertices[curFace], trisDrawnThisFace)
-			a := vertexToScreen(triangleVertices[i+0], model.Transform, cam, img.fs())
-			b := vertexToScreen(triangleVertices[i+1], model.Transform, cam, img.fs())
-			c := vertexToScreen(triangleVertices[i+2], model.Transform, cam, img.fs())
+	if min(a.Z, b.Z, c.Z) <= max(state.near, 0) { // skip tri if vertex is behind cam or too close
+		return
+	}
 
-			if a.Z <= 0 || b.Z <= 0 || c.Z <= 0 { // skip tri if vertex is behind cam
+	// triangle bounds
+	minX := min(min(a.X, b.X), c.X)
+	minY := min(min(a.Y, b.Y), c.Y)
+	maxX := max(max(a.X, b.X), c.X)
+	maxY := max(max(a.Y, b.Y), c.Y)
+
+	// pixel block covering bounds
+	blockStartX := clamp(minX, 0, img.fs().X-1)
+	blockStartY := clamp(minY, 0, img.fs().Y-1)
+	blockEndX := clamp(maxX, 0, img.fs().X-1)
+	blockEndY := clamp(maxY, 0, img.fs().Y-1)
+
+	depths := Float3{a.Z, b.Z, c.Z}
+
+	for y := int(blockStartY); y <= int(blockEndY); y++ {
+		for x := int(blockStartX); x <= int(blockEndX); x++ {
+			p := Float2{float64(x), float64(y)}
+			inTri, weights := pointInTriangle(a.make2(), b.make2(), c.make2(), p)
+			if !inTri {
 				continue
 			}
 
-			// triangle bounds
-			minX := min(min(a.X, b.X), c.X)
-			minY := min(min(a.Y, b.Y), c.Y)
-			maxX := max(max(a.X, b.X), c.X)
-			maxY := max(max(a.Y, b.Y), c.Y)
-
-			// pixel block covering bounds
-			blockStartX := clamp(minX, 0, img.fs().X-1)
-			blockStartY := clamp(minY, 0, img.fs().Y-1)
-			blockEndX := clamp(maxX, 0, img.fs().X-1)
-			blockEndY := clamp(maxY, 0, img.fs().Y-1)
-
-			for y := int(blockStartY); y <= int(blockEndY); y++ {
-				for x := int(blockStartX); x <= int(blockEndX); x++ {
-					p := Float2{float64(x), float64(y)}
-					inTri, weights := pointInTriangle(a.make2(), b.make2(), c.make2(), p)
-					if inTri {
-						// depth check
-						depths := Float3{a.Z, b.Z, c.Z}
-						depth := 1 / dot3(depths.under(1), weights)
-						if depth > img.depthBuffer[y][x] {
-							continue
-						}
-
-						// update pixel otherwise
-						if model.Shader == nil {
-							panic(fmt.Sprintf("No shader selected on model %v!", model.ID))
-						}
-
-						// texture weighting
-						var texCoord Float2
-						texCoord = texCoord.add(vertexTexCoords[i+0].mulscal(1 / depths.X).mulscal(weights.X))
-						texCoord = texCoord.add(vertexTexCoords[i+1].mulscal(1 / depths.Y).mulscal(weights.Y))
-						texCoord = texCoord.add(vertexTexCoords[i+2].mulscal(1 / depths.Z).mulscal(weights.Z))
-						texCoord = texCoord.mulscal(depth)
-
-						// normal weighting
-						var normal Float3
-						normal = normal.add(vertexNormals[i+0].mulscal(1 / depths.X).mulscal(weights.X))
-						normal = normal.add(vertexNormals[i+1].mulscal(1 / depths.Y).mulscal(weights.Y))
-						normal = normal.add(vertexNormals[i+2].mulscal(1 / depths.Z).mulscal(weights.Z))
-						normal = normal.mulscal(depth)
-						//ihat, jhat, khat := model.transform.GetInverseBasisVectors()
-						//rotatedNormal := ihat.mulscal(normal.x).add(jhat.mulscal(normal.y)).add(khat.mulscal(normal.z))
-
-						img.colorBuffer[y][x] = model.Shader.pixelColor(texCoord, normal, depth) //model.triangleCols[i/3].mulscal(0.1).add(model.shader.pixelColor(texCoord, normal).mulscal(0.9))
-						//println(texCoord.x, texCoord.y)
-						img.depthBuffer[y][x] = depth
-					}
-				}
+			// depth check
+			var depth float64
+			if state.linear { // orthographic, no perspective to correct for
+				depth = dot3(depths, weights)
+			} else {
+				depth = 1 / dot3(depths.under(1), weights)
+				weights = Float3{weights.X / depths.X, weights.Y / depths.Y, weights.Z / depths.Z}.mulscal(depth)
+			}
+			if state.far > 0 && depth > state.far {
+				continue
+			}
+			if state.depthTest && depth > img.depthBuffer[y][x] {
+				continue
+			}
+
+			// texture weighting
+			var texCoord Float2
+			texCoord = texCoord.add(texCoords[0].mulscal(weights.X))
+			texCoord = texCoord.add(texCoords[1].mulscal(weights.Y))
+			texCoord = texCoord.add(texCoords[2].mulscal(weights.Z))
+
+			// normal weighting
+			var normal Float3
+			normal = normal.add(normals[0].mulscal(weights.X))
+			normal = normal.add(normals[1].mulscal(weights.Y))
+			normal = normal.add(normals[2].mulscal(weights.Z))
+
+			color := shader.pixelColor(texCoord, normal, depth)
+			if state.tint != (Float3{}) {
+				color = color.mul(state.tint)
+			}
+			img.colorBuffer[y][x] = color
+			if state.depthWrite {
+				img.depthBuffer[y][x] = depth
+			}
+			if img.idBuffer != nil {
+				img.idBuffer[y][x] = Pick{state.id, state.face, state.instance, depth}
 			}
 		}
 	}
-
-	return img
 }
 
 // Image type
@@ -102,6 +127,10 @@ type Image struct {
 	depthBuffer [][]float64
 	w           int
 	h           int
+
+	idBuffer [][]Pick // optional, see EnableIDBuffer
+
+	path string // file it was loaded from, if any
 }
 
 func (i *Image) fillcb(color Float3) {
@@ -0,0 +1,157 @@
+package raster
+
+import "math"
+
+// ------------ RENDER TO TEXTURE -------------
+
+// a viewport with a Target renders into an Image that shaders can sample in
+// the same frame, e.g. a tv showing a security camera:
+//
+//	feed := raster.NewImage(128, 96)
+//	scene.Viewports = []raster.Viewport{{Cam: &securityCam, Target: &feed}, {}}
+//	tv.Shader = raster.NewTextureShader(feed)
+//
+// viewports are drawn so every target is finished before anything showing it.
+
+// shaders that sample images
+type texturedShader interface {
+	textures() []Image
+}
+
+func (t TextureShader) textures() []Image {
+	return []Image{t.texture}
+}
+
+func (lt LitTextureShader) textures() []Image {
+	return []Image{lt.Texture}
+}
+
+// do two images share pixels. a sub image only matches if it starts in the same corner
+func (i Image) sameAs(other Image) bool {
+	if len(i.colorBuffer) == 0 || len(i.colorBuffer[0]) == 0 || len(other.colorBuffer) == 0 || len(other.colorBuffer[0]) == 0 {
+		return false
+	}
+	return &i.colorBuffer[0][0] == &other.colorBuffer[0][0]
+}
+
+func usesTexture(shader Shader, img Image) bool {
+	textured, ok := shader.(texturedShader)
+	if !ok {
+		return false
+	}
+	for _, texture := range textured.textures() {
+		if texture.sameAs(img) {
+			return true
+		}
+	}
+	return false
+}
+
+// hidden models hide everything under them too
+func (m *Model) visible() bool {
+	for node := m; node != nil; node = node.parent {
+		if node.Hidden {
+			return false
+		}
+	}
+	return true
+}
+
+// the order to draw the viewports in. a viewport comes after any other
+// viewport whose target is on a visible model, otherwise the listed order is
+// kept. targets that show each other can't both go first, so in a loop the
+// earlier listed one gets last frame's picture.
+func (s Scene) passOrder() []Viewport {
+	viewports := s.viewports()
+
+	// which targets show up on screen somewhere
+	var shown []Image
+	for _, vp := range viewports {
+		if vp.Target == nil {
+			continue
+		}
+		isShown := false
+		s.eachModel(func(model *Model) {
+			isShown = isShown || (model.Shader != nil && model.visible() && usesTexture(model.Shader, *vp.Target))
+		})
+		if isShown {
+			shown = append(shown, *vp.Target)
+		}
+	}
+
+	// dependsOn[i] lists viewports that have to be drawn before i
+	dependsOn := make([][]int, len(viewports))
+	for i, vp := range viewports {
+		for j, other := range viewports {
+			if i == j || other.Target == nil {
+				continue
+			}
+			if vp.Target != nil && vp.Target.sameAs(*other.Target) {
+				continue // drawing into the same image, just keep their order
+			}
+			for _, img := range shown {
+				if img.sameAs(*other.Target) {
+					dependsOn[i] = append(dependsOn[i], j)
+					break
+				}
+			}
+		}
+	}
+
+	order := make([]Viewport, 0, len(viewports))
+	done := make([]bool, len(viewports))
+	for len(order) < len(viewports) {
+		next := -1
+		for i := range viewports {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, j := range dependsOn[i] {
+				ready = ready && done[j]
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 { // loop, break it at the first one left
+			for i := range viewports {
+				if !done[i] {
+					next = i
+					break
+				}
+			}
+		}
+		done[next] = true
+		order = append(order, viewports[next])
+	}
+	return order
+}
+
+// MirrorCamera is viewer's reflection in a flat mirror through point with the
+// given normal. render it into a target and put that on the mirror with its u
+// coordinates running right to left, since the picture itself isn't flipped.
+func MirrorCamera(viewer Camera, point, normal Float3) Camera {
+	normal = normal.normalized()
+	reflect := func(v Float3) Float3 {
+		return v.sub(normal.mulscal(2 * dot3(v, normal)))
+	}
+
+	mirror := viewer
+	mirror.parent = nil
+	mirror.Transform.Position = point.add(reflect(viewer.Position().sub(point)))
+	mirror.Transform.Scale = Float3{1, 1, 1}
+	mirror.LookAt(mirror.Transform.Position.add(reflect(viewer.Forward())))
+
+	// the mirror camera sits behind the mirror, so pull the near plane up to it or
+	// the wall the mirror hangs on hides everything. the near plane only matches
+	// the mirror straight ahead, looking at it at an angle clips a bit off either side
+	forward := mirror.Forward()
+	if facing := dot3(forward, normal); math.Abs(facing) > 1e-9 {
+		if distance := dot3(point.sub(mirror.Transform.Position), normal) / facing; distance > mirror.Near {
+			mirror.Near = distance
+		}
+	}
+	return mirror
+}
@@ -1,68 +1,215 @@
 package raster
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"slices"
 )
 
 // ------------ SCENE -------------
 
 type Scene struct {
-	Models  map[string]*Model
+	models  map[string]*Model
+	order   []*Model // insertion order, so iteration and drawing are deterministic
 	Cam     Camera
 	BGcol   Float3
 	Chunker *Chunker
+	Layers  map[RenderLayer]LayerSettings // layers not in here get the default settings
+
+	Viewports []Viewport // empty means Cam fills the whole window
 }
 
+var (
+	ErrNoSuchModel    = errors.New("no such model")
+	ErrDuplicateModel = errors.New("model ID not unique")
+)
+
 func NewScene() (s Scene) {
-	s.Models = make(map[string]*Model, 0)
-	s.Cam.fov = defaultFov
-	s.Cam.transform.Scale = Float3{1, 1, 1}
+	s.models = make(map[string]*Model, 0)
+	s.Layers = defaultLayerSettings()
+	s.Cam = NewCamera()
 	return
 }
 
-func (s *Scene) AddModel(model *Model) {
+func (s *Scene) AddModel(model *Model) error {
+	if model == nil {
+		return errors.New("can't add a nil model")
+	}
+	if s.models == nil {
+		s.models = make(map[string]*Model)
+	}
+
 	// ensure the id is unique
-	_, ok := s.Models[model.ID]
-	if ok {
-		fmt.Println("\033[31mModel ID not unique, was not loaded to scene.\033[0m")
-		return
+	if _, ok := s.models[model.ID]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateModel, model.ID)
 	}
 
 	// set it
-	s.Models[model.ID] = model
+	s.models[model.ID] = model
+	s.order = append(s.order, model)
+	return nil
 }
 
-func (s *Scene) GetModel(id string) *Model {
-	model, ok := s.Models[id]
+func (s *Scene) GetModel(id string) (*Model, error) {
+	model, ok := s.models[id]
 	if !ok {
-		panic(fmt.Sprintf("No such model %v!", id))
+		return nil, fmt.Errorf("%w: %q", ErrNoSuchModel, id)
 	}
-	return model
+	return model, nil
 }
 
-func renderScene(s Scene, target Image) (image Image) {
+func (s *Scene) HasModel(id string) bool {
+	_, ok := s.models[id]
+	return ok
+}
+
+// RemoveModel takes a model out of the scene, along with any of its children
+// that were added to the scene.
+func (s *Scene) RemoveModel(id string) error {
+	model, ok := s.models[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNoSuchModel, id)
+	}
+	model.SetParent(nil)
+
+	kept := s.order[:0]
+	for _, m := range s.order {
+		if m.isDescendantOf(model) {
+			delete(s.models, m.ID)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	s.order = kept
+
+	if s.Cam.parent != nil && s.Cam.parent.isDescendantOf(model) {
+		s.Cam.AttachTo(nil)
+	}
+	return nil
+}
+
+func (s *Scene) RenameModel(oldID, newID string) error {
+	model, ok := s.models[oldID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNoSuchModel, oldID)
+	}
+	if oldID == newID {
+		return nil
+	}
+	if _, ok := s.models[newID]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateModel, newID)
+	}
+
+	delete(s.models, oldID)
+	model.ID = newID
+	s.models[newID] = model
+	return nil
+}
+
+// Models lists every model in the scene in the order they were added
+func (s *Scene) Models() []*Model {
+	return append([]*Model(nil), s.order...)
+}
+
+// models carrying the tag, in the order they were added
+func (s *Scene) ModelsWithTag(tag string) (models []*Model) {
+	for _, model := range s.order {
+		if model.HasTag(tag) {
+			models = append(models, model)
+		}
+	}
+	return
+}
+
+// draw the scene from one camera into target. clearing is up to the caller.
+// models textured with feed, the image target is part of, are left out since
+// they'd be showing a half drawn picture of themselves
+func renderScene(s Scene, cam Camera, target Image, feed *Image) (image Image) {
 	image = target
-	for _, model := range s.Models {
-		image = render(image, Model(*model), s.Cam)
+
+	cam.prepare()
+	view := newFrustum(cam, image.fs())
+
+	// walk the graph down from each root
+	queue := make([]drawItem, 0, len(s.order))
+	for _, model := range s.order {
+		if model.parent == nil {
+			model.updateWorld(IdentityAffine())
+			queue = queueTree(queue, model, cam, view, image.fs())
+		}
 	}
+	showsFeed := func(shader Shader) bool {
+		return feed != nil && usesTexture(shader, *feed)
+	}
+	queue = slices.DeleteFunc(queue, func(item drawItem) bool {
+		return showsFeed(item.model.Shader)
+	})
+	stats.Models += len(queue)
+
 	if s.Chunker != nil {
-		s.Chunker.updateTerrainChunks(s.Cam.transform.Position, s.Chunker.resolution, s.Chunker.chunkSize)
 		for _, model := range s.Chunker.terrainChunksActive {
-			image = render(image, model, s.Cam)
+			if showsFeed(model.Shader) {
+				continue
+			}
+			model.world = model.Transform.Affine()
+			if view.culls(model.getMesh(), cam.view.Mul(model.world)) {
+				stats.ChunksCulled++
+				continue
+			}
+			stats.Chunks++
+			queue = append(queue, drawItem{model: model, layer: LayerOpaque, instance: -1})
 		}
 	}
 
-	return
+	sortQueue(queue)
+	return drawQueue(s, image, queue, cam)
 }
 
 // ------------ MODEL -------------
 
 type Model struct {
 	ID        string
-	Faces     []Face
-	Transform Transform
+	Faces     []Face     // polygon data as loaded
+	Mesh      *Mesh      // indexed triangles that actually get rendered
+	LODs      []*Mesh    // simplified versions of Mesh, see GenerateLODs
+	Instances []Instance // draw the mesh once per instance instead, see instance.go
+	Transform Transform  // relative to the parent model, if there is one
 	Shader    Shader
+	Hidden    bool        // skip drawing this model and its children
+	Layer     RenderLayer // which pass it's drawn in
+	SortKey   int         // draw order within the layer, lowest first
+	Tags      []string    // free-form labels, see Scene.ModelsWithTag
+
+	// scene graph, see hierarchy.go
+	parent   *Model
+	children []*Model
+	world    Affine // cached world transform, refreshed every frame
+
+	// where the geometry came from, so scene files can point back at it. only
+	// good while the mesh is the one built from there, see geometrySource
+	asset       string
+	primitive   *primitiveFile
+	sourceMesh  *Mesh
+	sourceEdits int
+
+	// the mesh GenerateLODs simplified and its edit count then, see dropStaleLODs
+	lodSource *Mesh
+	lodEdits  int
+}
+
+func (m *Model) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+func (m *Model) AddTag(tag string) {
+	if !m.HasTag(tag) {
+		m.Tags = append(m.Tags, tag)
+	}
+}
+
+func (m *Model) RemoveTag(tag string) {
+	m.Tags = slices.DeleteFunc(m.Tags, func(t string) bool { return t == tag })
 }
 
 type Transform struct {
@@ -173,6 +320,9 @@ func (f Face) getNumTriangles() int {
 }
 
 func (m Model) getNumTriangles() (n int) {
+	if m.Mesh != nil {
+		return m.Mesh.NumTriangles()
+	}
 	for _, face := range m.Faces {
 		n += face.getNumTriangles()
 	}
@@ -191,6 +341,7 @@ func NewModel(o ModelInitOptions) *Model {
 		panic("Blub")
 	} else if o.LoadFromPath {
 		model.Faces = loadObjFile(o.Path)
+		model.buildFromSource(o.Path, nil)
 	} else {
 		panic("No source point data configured while loading model!")
 	}
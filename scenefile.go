@@ -0,0 +1,741 @@
+package raster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ------------ SCENE FILES -------------
+
+// scenes are saved as json. angles are in degrees and asset paths are
+// relative to the scene file, so the file can be edited by hand.
+
+type vec3 [3]float64
+
+func toVec3(f Float3) vec3 {
+	return vec3{f.X, f.Y, f.Z}
+}
+
+func (v vec3) float3() Float3 {
+	return Float3{v[0], v[1], v[2]}
+}
+
+func optionalVec3(f Float3) *vec3 {
+	v := toVec3(f)
+	return &v
+}
+
+type transformFile struct {
+	Position vec3    `json:"position"`
+	Yaw      float64 `json:"yaw,omitempty"`
+	Pitch    float64 `json:"pitch,omitempty"`
+	Scale    *vec3   `json:"scale,omitempty"` // 1, 1, 1 if left out
+}
+
+// parameters for one of the generators in primitives.go. for planes segments
+// and rings are the x and z segments, for tori the major and minor segments.
+type primitiveFile struct {
+	Type        string  `json:"type"` // cube, plane, sphere, cylinder, cone, torus or capsule
+	Size        float64 `json:"size,omitempty"`
+	Width       float64 `json:"width,omitempty"`
+	Depth       float64 `json:"depth,omitempty"`
+	Radius      float64 `json:"radius,omitempty"`
+	MinorRadius float64 `json:"minorRadius,omitempty"`
+	Height      float64 `json:"height,omitempty"`
+	Segments    int     `json:"segments,omitempty"`
+	Rings       int     `json:"rings,omitempty"`
+}
+
+type shaderFile struct {
+	Type    string    `json:"type"` // lit, texture, litTexture or terrain
+	Color   *vec3     `json:"color,omitempty"`
+	Light   *vec3     `json:"light,omitempty"`   // direction to the light
+	Texture string    `json:"texture,omitempty"` // bmp
+	Colors  []vec3    `json:"colors,omitempty"`
+	Heights []float64 `json:"heights,omitempty"`
+	Fog     *vec3     `json:"fog,omitempty"` // terrain fog color, the background if left out
+}
+
+type modelFile struct {
+	ID        string         `json:"id"`
+	Asset     string         `json:"asset,omitempty"` // obj
+	Primitive *primitiveFile `json:"primitive,omitempty"`
+	Parent    string         `json:"parent,omitempty"`
+	Transform transformFile  `json:"transform"`
+	Shader    *shaderFile    `json:"shader,omitempty"`
+	Hidden    bool           `json:"hidden,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Layer     string         `json:"layer,omitempty"` // background, opaque, transparent or overlay
+	SortKey   int            `json:"sortKey,omitempty"`
+	Instances []instanceFile `json:"instances,omitempty"`
+}
+
+type instanceFile struct {
+	Transform transformFile `json:"transform"`
+	Tint      *vec3         `json:"tint,omitempty"`
+}
+
+var layerNames = map[RenderLayer]string{
+	LayerBackground:  "background",
+	LayerOpaque:      "opaque",
+	LayerTransparent: "transparent",
+	LayerOverlay:     "overlay",
+}
+
+func parseLayer(name string) (RenderLayer, error) {
+	if name == "" {
+		return LayerOpaque, nil
+	}
+	for layer, n := range layerNames {
+		if n == name {
+			return layer, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown layer %q", name)
+}
+
+// custom layers have no name, so they can't be saved
+func layerName(layer RenderLayer) (string, error) {
+	name, ok := layerNames[layer]
+	if !ok {
+		return "", fmt.Errorf("layer %d has no name and can't be saved", layer)
+	}
+	return name, nil
+}
+
+type layerFile struct {
+	ClearDepth   bool `json:"clearDepth,omitempty"`
+	NoDepthTest  bool `json:"noDepthTest,omitempty"`
+	NoDepthWrite bool `json:"noDepthWrite,omitempty"`
+}
+
+var projectionNames = map[Projection]string{
+	Perspective:  "perspective",
+	Orthographic: "orthographic",
+}
+
+type cameraFile struct {
+	Projection string        `json:"projection,omitempty"` // "perspective" or "orthographic"
+	FOV        float64       `json:"fov,omitempty"`
+	OrthoSize  float64       `json:"orthoSize,omitempty"`
+	Near       *float64      `json:"near,omitempty"`
+	Far        float64       `json:"far,omitempty"`
+	Aspect     float64       `json:"aspect,omitempty"`
+	Transform  transformFile `json:"transform"`
+	Parent     string        `json:"parent,omitempty"`
+}
+
+type chunkerFile struct {
+	Resolution  int          `json:"resolution,omitempty"`
+	ChunkSize   float64      `json:"chunkSize,omitempty"`
+	ViewRadius  int          `json:"viewRadius,omitempty"` // -1 for only the chunk under the camera
+	MaxChunks   int          `json:"maxChunks,omitempty"`
+	MemoryMB    float64      `json:"memoryMB,omitempty"` // chunk cache budget in megabytes
+	LODLevels   int          `json:"lodLevels,omitempty"`
+	LODStep     int          `json:"lodStep,omitempty"`
+	Workers     int          `json:"workers,omitempty"`
+	Synchronous bool         `json:"synchronous,omitempty"`
+	Shader      *shaderFile  `json:"shader,omitempty"`
+	Terrain     *terrainFile `json:"terrain,omitempty"`
+}
+
+// anything left out keeps its default. custom noise can't be saved
+type terrainFile struct {
+	Seed            int64   `json:"seed"`
+	Noise           string  `json:"noise"` // "openSimplex" or "perlin"
+	Layers          int     `json:"layers"`
+	Lacunarity      float64 `json:"lacunarity"`
+	Persistence     float64 `json:"persistence"`
+	RidgeLayerStart int     `json:"ridgeLayerStart"`
+	Frequency       float64 `json:"frequency"`
+	HeightScale     float64 `json:"heightScale"`
+	HeightOffset    float64 `json:"heightOffset"`
+	WaterLevel      float64 `json:"waterLevel"`
+	NoWater         bool    `json:"noWater,omitempty"`
+	JiggleStrength  float64 `json:"jiggleStrength"`
+
+	Heightmap *heightmapFile `json:"heightmap,omitempty"`
+	Erosion   *erosionFile   `json:"erosion,omitempty"`
+}
+
+type heightmapFile struct {
+	Path     string     `json:"path"` // png or raw, relative to the scene file
+	CellSize float64    `json:"cellSize"`
+	Min      float64    `json:"min"`
+	Max      float64    `json:"max"`
+	Center   [2]float64 `json:"center,omitempty"` // world x and z
+}
+
+// same fields as ErosionConfig so they convert straight across
+type erosionFile struct {
+	CellSize          float64 `json:"cellSize"`
+	TileCells         int     `json:"tileCells"`
+	Droplets          int     `json:"droplets"`
+	Lifetime          int     `json:"lifetime"`
+	Inertia           float64 `json:"inertia"`
+	Capacity          float64 `json:"capacity"`
+	ErodeRate         float64 `json:"erodeRate"`
+	DepositRate       float64 `json:"depositRate"`
+	Evaporation       float64 `json:"evaporation"`
+	Gravity           float64 `json:"gravity"`
+	Radius            int     `json:"radius"`
+	ThermalIterations int     `json:"thermalIterations"`
+	TalusSlope        float64 `json:"talusSlope"`
+	ThermalRate       float64 `json:"thermalRate"`
+}
+
+// like terrainFile, anything left out keeps its default
+func (f *erosionFile) UnmarshalJSON(data []byte) error {
+	type plain erosionFile
+	p := plain(DefaultErosionConfig())
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return err
+	}
+	*f = erosionFile(p)
+	return nil
+}
+
+var noiseNames = map[NoiseAlgorithm]string{
+	NoiseOpenSimplex: "openSimplex",
+	NoisePerlin:      "perlin",
+}
+
+// start from the defaults so partial terrain blocks work
+func (f *terrainFile) UnmarshalJSON(data []byte) error {
+	type plain terrainFile // without this method, so decoding doesn't loop
+	defaults, _ := toTerrainFile(DefaultTerrainConfig(), "")
+	p := plain(*defaults)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return err
+	}
+	*f = terrainFile(p)
+	return nil
+}
+
+func (f terrainFile) config(dir string) (TerrainConfig, error) {
+	c := TerrainConfig{
+		Seed:            f.Seed,
+		Layers:          f.Layers,
+		Lacunarity:      f.Lacunarity,
+		Persistence:     f.Persistence,
+		RidgeLayerStart: f.RidgeLayerStart,
+		Frequency:       f.Frequency,
+		HeightScale:     f.HeightScale,
+		HeightOffset:    f.HeightOffset,
+		WaterLevel:      f.WaterLevel,
+		NoWater:         f.NoWater,
+		JiggleStrength:  f.JiggleStrength,
+	}
+	if hf := f.Heightmap; hf != nil {
+		heightmap, err := LoadHeightmap(sceneRelative(dir, hf.Path))
+		if err != nil {
+			return c, err
+		}
+		c.Heightmap = &HeightmapTerrain{
+			Map:      heightmap,
+			CellSize: hf.CellSize,
+			Min:      hf.Min,
+			Max:      hf.Max,
+			Center:   Float2{hf.Center[0], hf.Center[1]},
+		}
+	}
+	if f.Erosion != nil {
+		erosion := ErosionConfig(*f.Erosion)
+		c.Erosion = &erosion
+	}
+	for algo, name := range noiseNames {
+		if name == f.Noise {
+			c.Noise = algo
+			return c, nil
+		}
+	}
+	return c, fmt.Errorf("unknown noise %q", f.Noise)
+}
+
+type sceneFile struct {
+	Background vec3                 `json:"background"`
+	Light      *vec3                `json:"light,omitempty"` // direction to the light for shaders that don't give one
+	Camera     cameraFile           `json:"camera"`
+	Models     []modelFile          `json:"models"`
+	Layers     map[string]layerFile `json:"layers,omitempty"` // replaces the default layer settings when given
+	Chunker    *chunkerFile         `json:"chunker,omitempty"`
+}
+
+// ---- loading
+
+func (f transformFile) transform() (t Transform) {
+	t.Position = f.Position.float3()
+	t.Scale = Float3{1, 1, 1}
+	if f.Scale != nil {
+		t.Scale = f.Scale.float3()
+	}
+	t.SetRotation(ToRadians(f.Pitch), ToRadians(f.Yaw))
+	return
+}
+
+func (f cameraFile) camera() (Camera, error) {
+	cam := NewCamera()
+	switch f.Projection {
+	case "", projectionNames[Perspective]:
+	case projectionNames[Orthographic]:
+		cam.Projection = Orthographic
+	default:
+		return cam, fmt.Errorf("unknown projection %q", f.Projection)
+	}
+	if f.FOV != 0 {
+		cam.FOV = ToRadians(f.FOV)
+	}
+	if f.OrthoSize != 0 {
+		cam.OrthoSize = f.OrthoSize
+	}
+	if f.Near != nil {
+		cam.Near = *f.Near
+	}
+	cam.Far = f.Far
+	cam.Aspect = f.Aspect
+	cam.Transform = f.Transform.transform()
+	return cam, nil
+}
+
+func (p primitiveFile) model(id string) (*Model, error) {
+	switch p.Type {
+	case "cube":
+		return NewCube(id, p.Size, p.Segments), nil
+	case "plane":
+		return NewPlane(id, p.Width, p.Depth, p.Segments, p.Rings), nil
+	case "sphere":
+		return NewSphere(id, p.Radius, p.Segments, p.Rings), nil
+	case "cylinder":
+		return NewCylinder(id, p.Radius, p.Height, p.Segments), nil
+	case "cone":
+		return NewCone(id, p.Radius, p.Height, p.Segments), nil
+	case "torus":
+		return NewTorus(id, p.Radius, p.MinorRadius, p.Segments, p.Rings), nil
+	case "capsule":
+		return NewCapsule(id, p.Radius, p.Height, p.Segments, p.Rings), nil
+	}
+	return nil, fmt.Errorf("unknown primitive %q", p.Type)
+}
+
+// resolve a path from the scene file against the file's directory
+func sceneRelative(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (f shaderFile) shader(dir string, defaults sceneFile) (Shader, error) {
+	light := Float3{0, 1, 0}
+	if defaults.Light != nil {
+		light = defaults.Light.float3()
+	}
+	if f.Light != nil {
+		light = f.Light.float3()
+	}
+	color := Float3{1, 1, 1}
+	if f.Color != nil {
+		color = f.Color.float3()
+	}
+	texture := func() (Image, error) {
+		if f.Texture == "" {
+			return Image{}, fmt.Errorf("%v shader needs a texture", f.Type)
+		}
+		return readBMP(sceneRelative(dir, f.Texture))
+	}
+
+	switch f.Type {
+	case "lit":
+		return LitShader{Color: color, DirectionToLight: light}, nil
+	case "texture":
+		img, err := texture()
+		return TextureShader{texture: img}, err
+	case "litTexture":
+		img, err := texture()
+		return LitTextureShader{Texture: img, DirectionToLight: light}, err
+	case "terrain":
+		shader := TerrainShader{DirectionToLight: light, Heights: f.Heights, BGcol: defaults.Background.float3()}
+		for _, c := range f.Colors {
+			shader.Colors = append(shader.Colors, c.float3())
+		}
+		if f.Fog != nil {
+			shader.BGcol = f.Fog.float3()
+		}
+		if shader.Colors != nil && len(shader.Colors) != len(shader.Heights)+1 {
+			return nil, errors.New("terrain shader needs one more color than heights")
+		}
+		return shader, nil
+	}
+	return nil, fmt.Errorf("unknown shader %q", f.Type)
+}
+
+// Load replaces the scene with the one described in a scene file
+func (s *Scene) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file sceneFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() // catch typos instead of silently ignoring them
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+
+	scene := NewScene()
+	scene.BGcol = file.Background.float3()
+	if file.Layers != nil {
+		scene.Layers = make(map[RenderLayer]LayerSettings)
+		for name, lf := range file.Layers {
+			layer, err := parseLayer(name)
+			if err != nil {
+				return fmt.Errorf("layers: %w", err)
+			}
+			scene.Layers[layer] = LayerSettings(lf)
+		}
+	}
+
+	for _, mf := range file.Models {
+		var model *Model
+		switch {
+		case mf.Asset != "":
+			faces, err := readObjFile(sceneRelative(dir, mf.Asset))
+			if err != nil {
+				return fmt.Errorf("model %q: %w", mf.ID, err)
+			}
+			model = &Model{ID: mf.ID, Faces: faces}
+			model.buildFromSource(sceneRelative(dir, mf.Asset), nil)
+		case mf.Primitive != nil:
+			model, err = mf.Primitive.model(mf.ID)
+			if err != nil {
+				return fmt.Errorf("model %q: %w", mf.ID, err)
+			}
+		default:
+			model = NewNode(mf.ID)
+		}
+
+		model.Transform = mf.Transform.transform()
+		if mf.Shader != nil {
+			model.Shader, err = mf.Shader.shader(dir, file)
+			if err != nil {
+				return fmt.Errorf("model %q: %w", mf.ID, err)
+			}
+		}
+
+		model.Hidden = mf.Hidden
+		model.Tags = mf.Tags
+		model.SortKey = mf.SortKey
+		for _, inst := range mf.Instances {
+			instance := Instance{Transform: inst.Transform.transform()}
+			if inst.Tint != nil {
+				instance.Tint = inst.Tint.float3()
+			}
+			model.AddInstance(instance)
+		}
+		if model.Layer, err = parseLayer(mf.Layer); err != nil {
+			return fmt.Errorf("model %q: %w", mf.ID, err)
+		}
+		if err := scene.AddModel(model); err != nil {
+			return err
+		}
+	}
+
+	// parents can come after their children in the file, so hook them up once everything exists
+	for _, mf := range file.Models {
+		if mf.Parent == "" {
+			continue
+		}
+		parent, err := scene.GetModel(mf.Parent)
+		if err != nil {
+			return fmt.Errorf("model %q: parent: %w", mf.ID, err)
+		}
+		if err := scene.models[mf.ID].SetParent(parent); err != nil {
+			return fmt.Errorf("model %q: %w", mf.ID, err)
+		}
+	}
+
+	scene.Cam, err = file.Camera.camera()
+	if err != nil {
+		return fmt.Errorf("camera: %w", err)
+	}
+	if file.Camera.Parent != "" {
+		parent, err := scene.GetModel(file.Camera.Parent)
+		if err != nil {
+			return fmt.Errorf("camera: parent: %w", err)
+		}
+		scene.Cam.AttachTo(parent)
+	}
+
+	if cf := file.Chunker; cf != nil {
+		options := ChunkerOptions{
+			Resolution:   cf.Resolution,
+			ChunkSize:    cf.ChunkSize,
+			ViewRadius:   cf.ViewRadius,
+			MaxChunks:    cf.MaxChunks,
+			MemoryBudget: int(cf.MemoryMB * (1 << 20)),
+			LODLevels:    cf.LODLevels,
+			LODStep:      cf.LODStep,
+			Workers:      cf.Workers,
+			Synchronous:  cf.Synchronous,
+		}
+		if cf.Shader != nil {
+			options.Shader, err = cf.Shader.shader(dir, file)
+			if err != nil {
+				return fmt.Errorf("chunker: %w", err)
+			}
+		}
+		if cf.Terrain != nil {
+			config, err := cf.Terrain.config(dir)
+			if err != nil {
+				return fmt.Errorf("chunker: terrain: %w", err)
+			}
+			options.Terrain = &config
+		}
+		if scene.Chunker, err = NewChunker(options); err != nil {
+			return fmt.Errorf("chunker: %w", err)
+		}
+	}
+
+	// the old chunker's workers would keep running with nothing to stop them
+	if s.Chunker != nil {
+		s.Chunker.Close()
+	}
+	*s = scene
+	return nil
+}
+
+// ---- saving
+
+func toDegrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
+
+func toTransformFile(t Transform) transformFile {
+	f := transformFile{Position: toVec3(t.Position), Yaw: toDegrees(t.Yaw), Pitch: toDegrees(t.Pitch)}
+	if t.Scale != (Float3{1, 1, 1}) {
+		f.Scale = optionalVec3(t.Scale)
+	}
+	return f
+}
+
+func toCameraFile(c Camera) cameraFile {
+	f := cameraFile{
+		FOV:       toDegrees(c.FOV),
+		Near:      &c.Near,
+		Far:       c.Far,
+		Aspect:    c.Aspect,
+		Transform: toTransformFile(c.Transform),
+	}
+	if c.Projection != Perspective {
+		f.Projection = projectionNames[c.Projection]
+		f.OrthoSize = c.OrthoSize
+	}
+	return f
+}
+
+func toTerrainFile(c TerrainConfig, dir string) (*terrainFile, error) {
+	name, ok := noiseNames[c.Noise]
+	if !ok {
+		return nil, errors.New("custom noise can't be saved")
+	}
+	var heightmap *heightmapFile
+	if t := c.Heightmap; t != nil {
+		if t.Map.path == "" {
+			return nil, errors.New("heightmap has to be loaded from or saved to a file first")
+		}
+		heightmap = &heightmapFile{
+			Path:     fileRelative(dir, t.Map.path),
+			CellSize: t.CellSize,
+			Min:      t.Min,
+			Max:      t.Max,
+			Center:   [2]float64{t.Center.X, t.Center.Y},
+		}
+	}
+	var erosion *erosionFile
+	if c.Erosion != nil {
+		erosion = (*erosionFile)(c.Erosion)
+	}
+	return &terrainFile{
+		Seed:            c.Seed,
+		Noise:           name,
+		Layers:          c.Layers,
+		Lacunarity:      c.Lacunarity,
+		Persistence:     c.Persistence,
+		RidgeLayerStart: c.RidgeLayerStart,
+		Frequency:       c.Frequency,
+		HeightScale:     c.HeightScale,
+		HeightOffset:    c.HeightOffset,
+		WaterLevel:      c.WaterLevel,
+		NoWater:         c.NoWater,
+		JiggleStrength:  c.JiggleStrength,
+		Heightmap:       heightmap,
+		Erosion:         erosion,
+	}, nil
+}
+
+// make a path relative to the scene file where possible
+func fileRelative(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+func toShaderFile(shader Shader, dir string) (*shaderFile, error) {
+	texturePath := func(img Image) (string, error) {
+		if img.path == "" {
+			return "", errors.New("texture wasn't loaded from a file")
+		}
+		return fileRelative(dir, img.path), nil
+	}
+
+	switch sh := shader.(type) {
+	case nil:
+		return nil, nil
+	case LitShader:
+		return &shaderFile{Type: "lit", Color: optionalVec3(sh.Color), Light: optionalVec3(sh.DirectionToLight)}, nil
+	case TextureShader:
+		path, err := texturePath(sh.texture)
+		return &shaderFile{Type: "texture", Texture: path}, err
+	case LitTextureShader:
+		path, err := texturePath(sh.Texture)
+		return &shaderFile{Type: "litTexture", Texture: path, Light: optionalVec3(sh.DirectionToLight)}, err
+	case TerrainShader:
+		f := &shaderFile{Type: "terrain", Light: optionalVec3(sh.DirectionToLight), Heights: sh.Heights, Fog: optionalVec3(sh.BGcol)}
+		for _, c := range sh.Colors {
+			f.Colors = append(f.Colors, toVec3(c))
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("can't save shader of type %T", shader)
+}
+
+// Save writes the scene out as a scene file. models have to come from an obj
+// file or a primitive generator, since the geometry itself isn't saved, and
+// can't have been subdivided, welded, moved and so on since.
+func (s *Scene) Save(path string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	file := sceneFile{
+		Background: toVec3(s.BGcol),
+		Camera:     toCameraFile(s.Cam),
+		Models:     make([]modelFile, 0, len(s.order)),
+	}
+	if len(s.Layers) > 0 {
+		file.Layers = make(map[string]layerFile)
+		for layer, settings := range s.Layers {
+			name, err := layerName(layer)
+			if err != nil {
+				return fmt.Errorf("layers: %w", err)
+			}
+			file.Layers[name] = layerFile(settings)
+		}
+	}
+
+	// children that were never added are saved too, they're found by walking the trees.
+	// a model hanging off a parent that isn't in the scene would be lost that way
+	for _, model := range s.order {
+		root := model
+		for root.parent != nil {
+			root = root.parent
+		}
+		if s.models[root.ID] != root {
+			return fmt.Errorf("model %q: %q above it isn't in the scene", model.ID, root.ID)
+		}
+	}
+	var models []*Model
+	s.eachModel(func(model *Model) {
+		models = append(models, model)
+	})
+
+	saved := make(map[string]bool, len(models))
+	for _, model := range models {
+		id := model.ID
+		if saved[id] {
+			return fmt.Errorf("%w: %q", ErrDuplicateModel, id)
+		}
+		saved[id] = true
+		asset, primitive := model.geometrySource()
+		mf := modelFile{ID: id, Transform: toTransformFile(model.Transform), Primitive: primitive, Hidden: model.Hidden, Tags: model.Tags, SortKey: model.SortKey}
+		if model.Layer != LayerOpaque {
+			if mf.Layer, err = layerName(model.Layer); err != nil {
+				return fmt.Errorf("model %q: %w", id, err)
+			}
+		}
+		for _, inst := range model.Instances {
+			instFile := instanceFile{Transform: toTransformFile(inst.Transform)}
+			if inst.Tint != (Float3{}) {
+				instFile.Tint = optionalVec3(inst.Tint)
+			}
+			mf.Instances = append(mf.Instances, instFile)
+		}
+		if asset != "" {
+			mf.Asset = fileRelative(dir, asset)
+		}
+		if mf.Asset == "" && mf.Primitive == nil && model.getNumTriangles() > 0 {
+			if model.asset != "" || model.primitive != nil {
+				return fmt.Errorf("model %q: geometry was changed after it was loaded or generated", id)
+			}
+			return fmt.Errorf("model %q: geometry didn't come from a file or primitive", id)
+		}
+		if model.parent != nil {
+			mf.Parent = model.parent.ID
+		}
+		if mf.Shader, err = toShaderFile(model.Shader, dir); err != nil {
+			return fmt.Errorf("model %q: %w", id, err)
+		}
+		file.Models = append(file.Models, mf)
+	}
+
+	if s.Cam.parent != nil {
+		if !slices.Contains(models, s.Cam.parent) {
+			return fmt.Errorf("camera: parent %q isn't in the scene", s.Cam.parent.ID)
+		}
+		file.Camera.Parent = s.Cam.parent.ID
+	}
+
+	if c := s.Chunker; c != nil {
+		file.Chunker = &chunkerFile{
+			Resolution:  c.resolution,
+			ChunkSize:   c.chunkSize,
+			ViewRadius:  c.Options().ViewRadius,
+			MaxChunks:   c.maxChunks,
+			MemoryMB:    float64(c.memoryBudget) / (1 << 20),
+			LODLevels:   c.lodLevels,
+			LODStep:     c.lodStep,
+			Workers:     c.workerCount,
+			Synchronous: c.synchronous,
+		}
+		if file.Chunker.Shader, err = toShaderFile(c.shader, dir); err != nil {
+			return fmt.Errorf("chunker: %w", err)
+		}
+		if file.Chunker.Terrain, err = toTerrainFile(c.TerrainConfig(), dir); err != nil {
+			return fmt.Errorf("chunker: terrain: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -1,8 +1,14 @@
 package raster
 
-import "math"
-
 const rotSpeed float64 = 0.03
 const moveSpeed float64 = 0.2
 
-const defaultFov float64 = 90 * math.Pi / 180.0
+// vertical, about 53 degrees. 2 * atan(0.5), the view is as tall as it is far away
+const defaultFov float64 = 0.9272952180016122
+
+const defaultOrthoSize float64 = 5
+const defaultNear float64 = 0.05
+const defaultFar float64 = 0 // no limit
+
+// lod selection aims for about this many screen pixels per triangle
+const lodPixelsPerTriangle float64 = 6
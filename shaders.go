@@ -8,16 +8,27 @@ import (
 
 // turn a bmp image into a colorbuffer
 func BMPToImage(path string) (image Image) {
+	image, err := readBMP(path)
+	Check(err)
+	return
+}
+
+func readBMP(path string) (image Image, err error) {
 	// load the bmp
 	file, err := os.Open(path)
-	Check(err)
+	if err != nil {
+		return
+	}
 	defer file.Close()
 
 	img, err := bmp.Decode(file)
-	Check(err)
+	if err != nil {
+		return
+	}
 
 	// extract the colors
 	image = newImage(img.Bounds().Dx(), img.Bounds().Dy())
+	image.path = path
 	for y := range img.Bounds().Dy() {
 		for x := range img.Bounds().Dx() {
 			c := img.At(x, y)
@@ -41,6 +52,11 @@ type TextureShader struct {
 	texture Image
 }
 
+// NewTextureShader draws a texture unlit, e.g. a Viewport's render target
+func NewTextureShader(texture Image) TextureShader {
+	return TextureShader{texture: texture}
+}
+
 func (t TextureShader) pixelColor(coord Float2, _ Float3, _ float64) Float3 {
 	return t.texture.sample(coord)
 }
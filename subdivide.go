@@ -0,0 +1,325 @@
+package raster
+
+import "math"
+
+// ------------ SUBDIVISION -------------
+
+type subdivEdge struct {
+	faces  []int
+	crease bool // open border or hard edge, kept sharp
+}
+
+// polygon faces welded by position, so the smoothing rules can see neighbours
+type subdivTopology struct {
+	positions  []Float3
+	faces      [][]int    // position ids per corner
+	texCoords  [][]Float2 // per corner, never welded so uv seams survive
+	edges      map[[2]int]*subdivEdge
+	neighbours [][]int
+}
+
+func edgeKey(a, b int) [2]int {
+	return [2]int{min(a, b), max(a, b)}
+}
+
+func newSubdivTopology(faces []Face) *subdivTopology {
+	t := &subdivTopology{edges: make(map[[2]int]*subdivEdge)}
+
+	lookup := make(map[Float3]int)
+	for _, face := range faces {
+		ids := make([]int, len(face.vertices))
+		for i, p := range face.vertices {
+			id, ok := lookup[p]
+			if !ok {
+				id = len(t.positions)
+				t.positions = append(t.positions, p)
+				lookup[p] = id
+			}
+			ids[i] = id
+		}
+		t.faces = append(t.faces, ids)
+		t.texCoords = append(t.texCoords, face.texCoords)
+	}
+	t.neighbours = make([][]int, len(t.positions))
+
+	// corner normal of face f at position p, for spotting hard edges
+	normalAt := func(f, p int) Float3 {
+		return faces[f].normals[indexOf(t.faces[f], p)]
+	}
+
+	for f, ids := range t.faces {
+		for i, a := range ids {
+			b := ids[(i+1)%len(ids)]
+			key := edgeKey(a, b)
+			edge, ok := t.edges[key]
+			if !ok {
+				edge = &subdivEdge{}
+				t.edges[key] = edge
+				t.neighbours[a] = append(t.neighbours[a], b)
+				t.neighbours[b] = append(t.neighbours[b], a)
+			}
+			edge.faces = append(edge.faces, f)
+		}
+	}
+
+	cosHard := math.Cos(hardEdgeAngle)
+	for key, edge := range t.edges {
+		if len(edge.faces) != 2 {
+			edge.crease = true
+			continue
+		}
+		f0, f1 := edge.faces[0], edge.faces[1]
+		for _, p := range key {
+			if dot3(normalAt(f0, p).normalized(), normalAt(f1, p).normalized()) < cosHard {
+				edge.crease = true
+			}
+		}
+	}
+	return t
+}
+
+// crease edges meeting at a position, and the positions on their other ends
+func (t *subdivTopology) creasesAt(p int) (ends []int) {
+	for _, n := range t.neighbours[p] {
+		if t.edges[edgeKey(p, n)].crease {
+			ends = append(ends, n)
+		}
+	}
+	return
+}
+
+// new position for an original vertex on a crease or corner. ok is false for smooth vertices
+func (t *subdivTopology) sharpVertex(p int) (Float3, bool) {
+	ends := t.creasesAt(p)
+	switch {
+	case len(ends) == 2:
+		return t.positions[p].mulscal(0.75).add(t.positions[ends[0]].add(t.positions[ends[1]]).mulscal(0.125)), true
+	case len(ends) > 2:
+		return t.positions[p], true // corner, stays put
+	}
+	return Float3{}, false
+}
+
+// give the faces normals again, smoothing everything but the hard edges
+func smoothFaceNormals(faces []Face) {
+	normalsAt := make(map[Float3][]Float3)
+	for _, face := range faces {
+		normal := polygonNormal(face.vertices)
+		for _, p := range face.vertices {
+			normalsAt[p] = append(normalsAt[p], normal)
+		}
+	}
+
+	cosHard := math.Cos(hardEdgeAngle)
+	for f := range faces {
+		own := polygonNormal(faces[f].vertices)
+		for i, p := range faces[f].vertices {
+			var normal Float3
+			for _, other := range normalsAt[p] {
+				if dot3(own, other) >= cosHard {
+					normal = normal.add(other)
+				}
+			}
+			faces[f].normals[i] = normal.normalized()
+		}
+	}
+}
+
+// one level of loop subdivision. every face must be a triangle
+func loopSubdivide(faces []Face) []Face {
+	t := newSubdivTopology(faces)
+
+	// original vertices
+	vertexPoints := make([]Float3, len(t.positions))
+	for p, position := range t.positions {
+		if sharp, ok := t.sharpVertex(p); ok {
+			vertexPoints[p] = sharp
+			continue
+		}
+		n := float64(len(t.neighbours[p]))
+		beta := 3.0 / (8 * n)
+		if n == 3 {
+			beta = 3.0 / 16
+		}
+		var sum Float3
+		for _, q := range t.neighbours[p] {
+			sum = sum.add(t.positions[q])
+		}
+		vertexPoints[p] = position.mulscal(1 - n*beta).add(sum.mulscal(beta))
+	}
+
+	// new vertices on the edges
+	edgePoints := make(map[[2]int]Float3, len(t.edges))
+	for key, edge := range t.edges {
+		a, b := t.positions[key[0]], t.positions[key[1]]
+		if edge.crease {
+			edgePoints[key] = a.add(b).mulscal(0.5)
+			continue
+		}
+		var opposite Float3
+		for _, f := range edge.faces {
+			for _, q := range t.faces[f] {
+				if q != key[0] && q != key[1] {
+					opposite = opposite.add(t.positions[q])
+				}
+			}
+		}
+		edgePoints[key] = a.add(b).mulscal(3.0 / 8).add(opposite.mulscal(1.0 / 8))
+	}
+
+	// every triangle becomes four
+	out := make([]Face, 0, len(faces)*4)
+	for f, ids := range t.faces {
+		uv := t.texCoords[f]
+		corner := [3]Float3{vertexPoints[ids[0]], vertexPoints[ids[1]], vertexPoints[ids[2]]}
+		mid := [3]Float3{edgePoints[edgeKey(ids[0], ids[1])], edgePoints[edgeKey(ids[1], ids[2])], edgePoints[edgeKey(ids[2], ids[0])]}
+		midUV := [3]Float2{uv[0].add(uv[1]).mulscal(0.5), uv[1].add(uv[2]).mulscal(0.5), uv[2].add(uv[0]).mulscal(0.5)}
+
+		tris := [4][3]struct {
+			p  Float3
+			uv Float2
+		}{
+			{{corner[0], uv[0]}, {mid[0], midUV[0]}, {mid[2], midUV[2]}},
+			{{mid[0], midUV[0]}, {corner[1], uv[1]}, {mid[1], midUV[1]}},
+			{{mid[2], midUV[2]}, {mid[1], midUV[1]}, {corner[2], uv[2]}},
+			{{mid[0], midUV[0]}, {mid[1], midUV[1]}, {mid[2], midUV[2]}},
+		}
+		for _, tri := range tris {
+			out = append(out, Face{
+				vertices:  []Float3{tri[0].p, tri[1].p, tri[2].p},
+				texCoords: []Float2{tri[0].uv, tri[1].uv, tri[2].uv},
+				normals:   make([]Float3, 3),
+			})
+		}
+	}
+	return out
+}
+
+// one level of catmull-clark subdivision. any polygons work, the result is all quads
+func catmullClarkSubdivide(faces []Face) []Face {
+	t := newSubdivTopology(faces)
+
+	facePoints := make([]Float3, len(t.faces))
+	for f, ids := range t.faces {
+		for _, p := range ids {
+			facePoints[f] = facePoints[f].add(t.positions[p])
+		}
+		facePoints[f] = facePoints[f].mulscal(1 / float64(len(ids)))
+	}
+
+	edgePoints := make(map[[2]int]Float3, len(t.edges))
+	for key, edge := range t.edges {
+		a, b := t.positions[key[0]], t.positions[key[1]]
+		if edge.crease {
+			edgePoints[key] = a.add(b).mulscal(0.5)
+			continue
+		}
+		edgePoints[key] = a.add(b).add(facePoints[edge.faces[0]]).add(facePoints[edge.faces[1]]).mulscal(0.25)
+	}
+
+	// faces touching each position
+	facesAt := make([][]int, len(t.positions))
+	for f, ids := range t.faces {
+		for _, p := range ids {
+			facesAt[p] = append(facesAt[p], f)
+		}
+	}
+
+	vertexPoints := make([]Float3, len(t.positions))
+	for p, position := range t.positions {
+		if sharp, ok := t.sharpVertex(p); ok {
+			vertexPoints[p] = sharp
+			continue
+		}
+		n := float64(len(t.neighbours[p]))
+		var faceAvg, edgeAvg Float3
+		for _, f := range facesAt[p] {
+			faceAvg = faceAvg.add(facePoints[f])
+		}
+		faceAvg = faceAvg.mulscal(1 / float64(len(facesAt[p])))
+		for _, q := range t.neighbours[p] {
+			edgeAvg = edgeAvg.add(position.add(t.positions[q]).mulscal(0.5))
+		}
+		edgeAvg = edgeAvg.mulscal(1 / n)
+		vertexPoints[p] = faceAvg.add(edgeAvg.mulscal(2)).add(position.mulscal(n - 3)).mulscal(1 / n)
+	}
+
+	// every n-gon becomes n quads around its face point
+	out := make([]Face, 0, len(faces)*4)
+	for f, ids := range t.faces {
+		uv := t.texCoords[f]
+		n := len(ids)
+		var centerUV Float2
+		for _, c := range uv {
+			centerUV = centerUV.add(c)
+		}
+		centerUV = centerUV.mulscal(1 / float64(n))
+
+		for i := range ids {
+			prev, next := (i+n-1)%n, (i+1)%n
+			out = append(out, Face{
+				vertices: []Float3{
+					vertexPoints[ids[i]],
+					edgePoints[edgeKey(ids[i], ids[next])],
+					facePoints[f],
+					edgePoints[edgeKey(ids[prev], ids[i])],
+				},
+				texCoords: []Float2{
+					uv[i],
+					uv[i].add(uv[next]).mulscal(0.5),
+					centerUV,
+					uv[prev].add(uv[i]).mulscal(0.5),
+				},
+				normals: make([]Float3, 4),
+			})
+		}
+	}
+	return out
+}
+
+// turn the triangles back into faces
+func (m *Mesh) faces() []Face {
+	faces := make([]Face, 0, m.NumTriangles())
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		var f Face
+		for _, v := range m.Indices[i : i+3] {
+			f.vertices = append(f.vertices, m.Positions[v])
+			f.texCoords = append(f.texCoords, m.TexCoords[v])
+			f.normals = append(f.normals, m.Normals[v])
+		}
+		faces = append(faces, f)
+	}
+	return faces
+}
+
+// SubdivideLoop smooths the model with loop subdivision, splitting every
+// triangle into four per level. uvs are interpolated and hard edges stay sharp.
+func (m *Model) SubdivideLoop(levels int) {
+	// loop only works on triangles, so go through the mesh even if there's only
+	// polygons so far
+	faces := m.getMesh().faces()
+	for range levels {
+		faces = loopSubdivide(faces)
+		smoothFaceNormals(faces)
+	}
+	m.Faces = faces
+	m.BuildMesh()
+	m.LODs = nil
+}
+
+// SubdivideCatmullClark smooths the model with catmull-clark subdivision,
+// turning every n-gon into n quads per level. works best on quad meshes.
+// uvs are interpolated and hard edges stay sharp.
+func (m *Model) SubdivideCatmullClark(levels int) {
+	faces := m.Faces
+	if len(faces) == 0 && m.Mesh != nil {
+		faces = m.Mesh.faces()
+	}
+	for range levels {
+		faces = catmullClarkSubdivide(faces)
+		smoothFaceNormals(faces)
+	}
+	m.Faces = faces
+	m.BuildMesh()
+	m.LODs = nil
+}
@@ -1,41 +1,103 @@
 package raster
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/rand/v2"
 
 	"github.com/KEINOS/go-noise"
+	"github.com/ojrac/opensimplex-go"
 )
 
-const seed int64 = 42
+// terrain generation with a particular config. chunks made by the same
+// generator line up with each other
+type terrainGen struct {
+	config  TerrainConfig
+	noise   noise.Generator
+	erosion *erosionTiles // nil without TerrainConfig.Erosion
+}
 
-var noiseGen, _ = noise.New(noise.OpenSimplex, seed)
+func newTerrainGen(config TerrainConfig) (*terrainGen, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	algo := map[NoiseAlgorithm]noise.Algo{
+		NoiseOpenSimplex: noise.OpenSimplex,
+		NoisePerlin:      noise.Perlin,
+		NoiseCustom:      noise.Custom,
+	}[config.Noise]
+	gen, err := noise.New(algo, config.Seed)
+	if err != nil {
+		return nil, err
+	}
+	if config.Noise == NoiseOpenSimplex {
+		gen = simplexNoise{gen, opensimplex.New(config.Seed)}
+	}
+	if config.Noise == NoiseCustom {
+		custom := config.CustomNoise
+		err = gen.SetEval64(func(seed int64, dim ...float64) float64 {
+			return custom(seed, dim[0], dim[1])
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	t := &terrainGen{config: config, noise: gen}
+	if config.Erosion != nil {
+		t.erosion = newErosionTiles(t, *config.Erosion)
+	}
+	return t, nil
+}
+
+// go-noise builds its simplex tables again on every call, and erosion makes a
+// lot of calls. this is the same noise with the tables built once
+type simplexNoise struct {
+	noise.Generator
+	tables opensimplex.Noise
+}
+
+func (s simplexNoise) Eval64(dim ...float64) float64 {
+	return s.tables.Eval2(dim[0], dim[1])
+}
+
+func (t *terrainGen) elevation(pos Float2) float64 {
+	elevation := t.rawElevation(pos)
+	if t.erosion != nil {
+		elevation += t.erosion.delta(pos)
+	}
+	if !t.config.NoWater {
+		elevation = max(t.config.WaterLevel, elevation)
+	}
+	return elevation
+}
 
-func calculateElevation(pos Float2) float64 {
-	const layerCount int = 5
-	const lacunarity float64 = 2      // how fast detail increases per layer
-	const persistence float64 = 0.5   // how quickly strength of layers decrease
-	const ridgeLayerStart float64 = 3 // make noise more ridge like later on
+// before erosion and water
+func (t *terrainGen) rawElevation(pos Float2) float64 {
+	cfg := t.config
+	if cfg.Heightmap != nil {
+		// pos is where the noise would be sampled, the map is laid out in the world
+		return cfg.Heightmap.height(pos.X+chunkOffset.X, pos.Y+chunkOffset.Z) - chunkOffset.Y
+	}
 
-	frequency := 0.05
+	frequency := cfg.Frequency
 	amplitude := 1.0
 	elevation := 0.0
 
-	for i := range layerCount {
-		n := noiseGen.Eval64(pos.X*frequency, pos.Y*frequency)
-		if i >= int(ridgeLayerStart) {
+	for i := range cfg.Layers {
+		n := t.noise.Eval64(pos.X*frequency, pos.Y*frequency)
+		if i >= cfg.RidgeLayerStart { // make noise more ridge like later on
 			n = 0.5 - math.Abs(n)
 		}
 		elevation += n * amplitude
-		amplitude *= persistence
-		frequency *= lacunarity
+		amplitude *= cfg.Persistence
+		frequency *= cfg.Lacunarity
 	}
 
-	return elevation * 10
+	return elevation*cfg.HeightScale + cfg.HeightOffset
 }
 
-func generatePointMap(resolution int, worldSize float64, gridCenter Float2) (pointMap [][]Float3) {
+func (t *terrainGen) pointMap(resolution int, worldSize float64, gridCenter Float2) (pointMap [][]Float3) {
 	// make the pointmap
 	pointMap = make([][]Float3, resolution)
 	for i := range pointMap {
@@ -46,26 +108,29 @@ func generatePointMap(resolution int, worldSize float64, gridCenter Float2) (poi
 		for x := range resolution {
 			localGridPos_sNorm := Float2{float64(x), float64(y)}.mulscal(1.0 / (float64(resolution) - 1.0)).sub(Float2{0.5, 0.5})
 			gridWorldPos := gridCenter.add(localGridPos_sNorm.mulscal(worldSize))
-			gridWorldPos = calculateJiggle(gridWorldPos)
-			elevation := max(0, calculateElevation(gridWorldPos)+1.8)
-			pointMap[y][x] = Float3{gridWorldPos.X, elevation, gridWorldPos.Y}
+			gridWorldPos = t.jiggle(gridWorldPos)
+			pointMap[y][x] = Float3{gridWorldPos.X, t.elevation(gridWorldPos), gridWorldPos.Y}
 		}
 	}
 
 	return
 }
 
-func calculateJiggle(v Float2) Float2 {
-	const jiggleStrength float64 = 0.05
+func (t *terrainGen) jiggle(v Float2) Float2 {
+	strength := t.config.JiggleStrength
 	return Float2{
-		v.X + noiseGen.Eval64(v.X+1000, v.Y+1000)*jiggleStrength,
-		v.Y + noiseGen.Eval64(v.X-1000, v.Y-1000)*jiggleStrength,
+		v.X + t.noise.Eval64(v.X+1000, v.Y+1000)*strength,
+		v.Y + t.noise.Eval64(v.X-1000, v.Y-1000)*strength,
 	}
 }
 
-func generateTerrain(resolution int, worldsize float64, gridCenter Float2, shader Shader, name ...string) *Model {
-	pointMap := generatePointMap(resolution, worldsize, gridCenter)
-	faces := make([]Face, 0)
+// chunks are drawn shifted from where their noise was sampled
+var chunkOffset = Float3{0, 0, 10}
+
+// skirt is how deep to hang a skirt around the edges, 0 for none. see addSkirt
+func generateTerrain(gen *terrainGen, resolution int, worldsize float64, gridCenter Float2, skirt float64, shader Shader, name ...string) *Model {
+	pointMap := gen.pointMap(resolution, worldsize, gridCenter)
+	mesh := &Mesh{}
 
 	for y := range resolution - 1 {
 		for x := range resolution - 1 {
@@ -76,24 +141,19 @@ func generateTerrain(resolution int, worldsize float64, gridCenter Float2, shade
 			t2 := Float2{b.Y + d.Y + c.Y, 0.0}.mulscal(1.0 / 3.0)
 
 			// normals
-			n1 := cross3(b.sub(a), c.sub(b)).normalized() // tri 1
-			n2 := cross3(d.sub(b), c.sub(d)).normalized() // tri 2
-
-			faces = append(faces, Face{
-				vertices:  []Float3{a, b, c},
-				texCoords: []Float2{t1, t1, t1},
-				normals:   []Float3{n1, n1, n1},
-			})
-
-			faces = append(faces, Face{
-				vertices:  []Float3{b, d, c},
-				texCoords: []Float2{t2, t2, t2},
-				normals:   []Float3{n2, n2, n2},
-			})
+			n1 := triangleNormal(a, b, c) // tri 1
+			n2 := triangleNormal(b, d, c) // tri 2
 
+			// flat shaded, so every triangle gets its own vertices
+			mesh.addTriangle(mesh.appendVertex(a, t1, n1), mesh.appendVertex(b, t1, n1), mesh.appendVertex(c, t1, n1))
+			mesh.addTriangle(mesh.appendVertex(b, t2, n2), mesh.appendVertex(d, t2, n2), mesh.appendVertex(c, t2, n2))
 		}
 	}
 
+	if skirt > 0 {
+		addSkirt(mesh, pointMap, skirt, Float3{gridCenter.X, 0, gridCenter.Y})
+	}
+
 	// assign a random id
 	var id string
 	if len(name) >= 1 {
@@ -104,44 +164,387 @@ func generateTerrain(resolution int, worldsize float64, gridCenter Float2, shade
 
 	return &Model{
 		ID:        id,
-		Faces:     faces,
-		Transform: Transform{Position: Float3{0, 0, 10}, Scale: Float3{1, 1, 1}},
+		Mesh:      mesh,
+		Transform: Transform{Position: chunkOffset, Scale: Float3{1, 1, 1}},
 		Shader:    shader,
 	}
 }
 
 // chunking
 
+// a Chunker belongs to whatever renders it and isn't safe to share between
+// goroutines. only its own workers run in the background, see chunkworkers.go
 type Chunker struct {
 	terrainChunksActive []Model
-	terrainChunkLookup  map[[2]int]Model
+	terrainChunkLookup  *chunkCache
 	shader              Shader
 
-	resolution int
-	chunkSize  float64
+	resolution   int
+	chunkSize    float64
+	viewRadius   int
+	maxChunks    int
+	memoryBudget int
+	synchronous  bool
+	workerCount  int
+	lodLevels    int
+	lodStep      int
+
+	gen *terrainGen // nil until first used, then made from the default config
+
+	workers      *chunkWorkers    // started on first use
+	epoch        int              // bumped whenever cached chunks go stale, so late results get dropped
+	placeholders map[[2]int]Model // drawn while the real chunk is being made
+
+	heightCache map[chunkPointsKey][][]Float3 // point maps by chunk and how it's drawn, for HeightAt and NormalAt
+	drawn       map[[2]int]chunkDrawing       // how each chunk in view is drawn right now
 }
 
-func (c *Chunker) updateTerrainChunks(camPos Float3, resolution int, chunkSize float64) {
+type ChunkerOptions struct {
+	ViewRadius int     // chunks kept around the camera in each direction, 2 gives a 5x5 grid. see OnlyCameraChunk
+	ChunkSize  float64 // world units along each side of a chunk
+	Resolution int     // grid points along each side of a chunk
+	Shader     Shader
+
+	// limits on the chunk cache, 0 means no limit. chunks in view are always kept
+	MaxChunks    int // chunks kept in memory
+	MemoryBudget int // bytes of mesh data kept in memory, roughly
+
+	// far chunks get generated at lower resolution, see terrainlod.go
+	LODLevels int // how many times far chunks can halve their resolution, 0 turns lod off
+	LODStep   int // rings of chunks between each halving, 0 means 1
+
+	Workers     int  // background chunk generators, 0 picks one per cpu
+	Synchronous bool // generate chunks inside the render call instead, stalling until they're done
+
+	Terrain *TerrainConfig // nil uses DefaultTerrainConfig, or keeps the current one in Reconfigure
+}
+
+// ViewRadius for keeping just the chunk the camera is over. 0 can't mean
+// that since it picks the default, like every other option
+const OnlyCameraChunk = -1
+
+const (
+	defaultViewRadius = 2
+	defaultChunkSize  = 20
+	defaultResolution = 30
+)
+
+// zero values get the defaults
+func (o ChunkerOptions) withDefaults() ChunkerOptions {
+	switch o.ViewRadius {
+	case 0:
+		o.ViewRadius = defaultViewRadius
+	case OnlyCameraChunk:
+		o.ViewRadius = 0
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = defaultChunkSize
+	}
+	if o.Resolution == 0 {
+		o.Resolution = defaultResolution
+	}
+	if o.Shader == nil {
+		o.Shader = TerrainShader{}
+	}
+	if o.LODStep == 0 {
+		o.LODStep = 1
+	}
+	return o
+}
+
+func (o ChunkerOptions) validate() error {
+	switch {
+	case o.ViewRadius < 0:
+		return errors.New("chunker view radius can't be negative, other than OnlyCameraChunk")
+	case o.ChunkSize <= 0:
+		return errors.New("chunk size has to be positive")
+	case o.Resolution < 2:
+		return errors.New("chunk resolution has to be at least 2")
+	case o.MaxChunks < 0 || o.MemoryBudget < 0:
+		return errors.New("chunk cache limits can't be negative")
+	case o.LODLevels < 0 || o.LODStep < 0:
+		return errors.New("chunker lod settings can't be negative")
+	case o.Workers < 0:
+		return errors.New("chunker worker count can't be negative")
+	}
+	return nil
+}
+
+func NewChunker(o ChunkerOptions) (*Chunker, error) {
+	c := &Chunker{}
+	if o.Terrain == nil {
+		defaults := DefaultTerrainConfig()
+		o.Terrain = &defaults
+	}
+	if err := c.Reconfigure(o); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Options are the chunker's current settings, ready to be changed and passed to Reconfigure
+func (c *Chunker) Options() ChunkerOptions {
+	terrain := c.TerrainConfig()
+	viewRadius := c.viewRadius
+	if viewRadius == 0 {
+		viewRadius = OnlyCameraChunk
+	}
+	return ChunkerOptions{
+		ViewRadius:   viewRadius,
+		ChunkSize:    c.chunkSize,
+		Resolution:   c.resolution,
+		Shader:       c.shader,
+		MaxChunks:    c.maxChunks,
+		MemoryBudget: c.memoryBudget,
+		LODLevels:    c.lodLevels,
+		LODStep:      c.lodStep,
+		Workers:      c.workerCount,
+		Synchronous:  c.synchronous,
+		Terrain:      &terrain,
+	}
+}
+
+// Reconfigure changes the chunker's settings on the fly. changing the chunk
+// size, resolution or terrain throws away every chunk made so far. zero
+// values get the defaults, like in NewChunker
+func (c *Chunker) Reconfigure(o ChunkerOptions) error {
+	o = o.withDefaults()
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if o.Terrain != nil && (c.gen == nil || !c.gen.config.equal(*o.Terrain)) {
+		if err := c.SetTerrainConfig(*o.Terrain); err != nil {
+			return err
+		}
+	}
+
+	if o.ChunkSize != c.chunkSize || o.Resolution != c.resolution || o.LODLevels != c.lodLevels || o.LODStep != c.lodStep {
+		c.clearChunks()
+	}
+	c.lodLevels = o.LODLevels
+	c.lodStep = o.LODStep
+	c.viewRadius = o.ViewRadius
+	c.chunkSize = o.ChunkSize
+	c.resolution = o.Resolution
+	c.maxChunks = o.MaxChunks
+	c.memoryBudget = o.MemoryBudget
+	if o.Workers != c.workerCount || o.Synchronous {
+		c.Close() // a new pool gets started when it's next needed
+	}
+	c.workerCount = o.Workers
+	c.synchronous = o.Synchronous
+	c.SetShader(o.Shader)
+	if c.terrainChunkLookup != nil {
+		c.terrainChunkLookup.evict(c.maxChunks, c.memoryBudget, len(c.terrainChunksActive))
+	}
+	return nil
+}
+
+// SetShader changes the shader of every chunk, without regenerating anything
+func (c *Chunker) SetShader(shader Shader) {
+	c.shader = shader
+	if c.terrainChunkLookup != nil {
+		c.terrainChunkLookup.each(func(chunk *Model) { chunk.Shader = shader })
+	}
+	for i := range c.terrainChunksActive {
+		c.terrainChunksActive[i].Shader = shader
+	}
+	for key, chunk := range c.placeholders {
+		chunk.Shader = shader
+		c.placeholders[key] = chunk
+	}
+}
+
+// TerrainConfig is what the chunker is currently generating with
+func (c *Chunker) TerrainConfig() TerrainConfig {
+	return c.generator().config
+}
+
+// SetTerrainConfig switches to generating a different world. chunks made
+// with the old config are thrown away
+func (c *Chunker) SetTerrainConfig(config TerrainConfig) error {
+	gen, err := newTerrainGen(config)
+	if err != nil {
+		return err
+	}
+	c.gen = gen
+	c.clearChunks()
+	return nil
+}
+
+func (c *Chunker) clearChunks() {
+	if c.terrainChunkLookup != nil {
+		stats := c.terrainChunkLookup.stats
+		c.terrainChunkLookup = newChunkCache()
+		c.terrainChunkLookup.stats = ChunkCacheStats{Hits: stats.Hits, Misses: stats.Misses, Evictions: stats.Evictions}
+	}
+	c.terrainChunksActive = nil
+	c.placeholders = nil
+	c.heightCache = nil
+	c.drawn = nil
+	c.epoch++
+	if c.workers != nil {
+		c.workers.keepOnly(nil)
+	}
+}
+
+// Close stops the background workers. the chunker still works afterwards,
+// it'll just start them again
+func (c *Chunker) Close() {
+	if c.workers != nil {
+		c.workers.close()
+		c.workers = nil
+	}
+}
+
+// PendingChunks is how many chunks are waiting on or being made by the workers
+func (c *Chunker) PendingChunks() int {
+	if c.workers == nil {
+		return 0
+	}
+	return c.workers.pending()
+}
+
+// CacheStats says how well the chunk cache is doing
+func (c *Chunker) CacheStats() ChunkCacheStats {
+	if c.terrainChunkLookup == nil {
+		return ChunkCacheStats{}
+	}
+	return c.terrainChunkLookup.stats
+}
+
+func (c *Chunker) generator() *terrainGen {
+	if c.gen == nil {
+		c.gen, _ = newTerrainGen(DefaultTerrainConfig()) // the defaults are always valid
+	}
+	return c.gen
+}
+
+// the same terrain without erosion, for placeholders. they're made on the render
+// thread right away, and eroding the tiles under them takes far too long for that
+func (c *Chunker) roughGenerator() *terrainGen {
+	rough := *c.generator()
+	rough.erosion = nil
+	return &rough
+}
+
+func (c *Chunker) updateTerrainChunks(camPos Float3) {
 	if c.terrainChunkLookup == nil {
-		c.terrainChunkLookup = make(map[[2]int]Model)
+		c.terrainChunkLookup = newChunkCache()
+	}
+	if !c.synchronous {
+		c.collectChunks()
 	}
 
-	centerX := int(math.Round(camPos.X / chunkSize))
-	centerY := int(math.Round(camPos.Z / chunkSize))
+	centerX := int(math.Round(camPos.X / c.chunkSize))
+	centerY := int(math.Round(camPos.Z / c.chunkSize))
 	c.terrainChunksActive = make([]Model, 0) // clear
+	c.drawn = make(map[[2]int]chunkDrawing)
+	wanted := make(map[chunkKey]bool)
 
-	// create a 5x5 grid of terrain chunks centered around camera position
-	for y := centerY - 2; y <= centerY+2; y++ {
-		for x := centerX - 2; x <= centerX+2; x++ {
-			chunk, ok := c.terrainChunkLookup[[2]int{x, y}]
+	// create a grid of terrain chunks centered around camera position
+	r := c.viewRadius
+	for y := centerY - r; y <= centerY+r; y++ {
+		for x := centerX - r; x <= centerX+r; x++ {
+			ring := max(abs(x-centerX), abs(y-centerY))
+			key := chunkKey{x, y, c.lodLevel(ring)}
+			wanted[key] = true
+			chunk, ok := c.terrainChunkLookup.get(key)
+			drawing := chunkDrawing{resolution: c.levelResolution(key.level)}
 			if !ok {
-				center := Float2{float64(x) * chunkSize, float64(y) * chunkSize} // chunk center in world sapce
-				chunk = *generateTerrain(resolution, chunkSize, center, c.shader)
-				chunk.Transform.UpdateBases()
+				if c.synchronous {
+					chunk = c.generateChunk(c.generator(), key, drawing.resolution)
+					c.terrainChunkLookup.put(key, chunk) // add to the lookup table
+					c.terrainChunkLookup.stats.Misses++
+				} else {
+					c.requestChunk(key, camPos)
+					chunk, drawing = c.placeholder(key)
+				}
 			}
 
 			c.terrainChunksActive = append(c.terrainChunksActive, chunk) // add to draw list
-			c.terrainChunkLookup[[2]int{x, y}] = chunk                   // add to the lookup table
+			c.drawn[key.pos()] = drawing
+		}
+	}
+
+	if c.workers != nil {
+		c.workers.keepOnly(wanted)
+	}
+	if !c.synchronous {
+		for pos := range c.placeholders {
+			if max(abs(pos[0]-centerX), abs(pos[1]-centerY)) > r { // out of view
+				delete(c.placeholders, pos)
+			}
 		}
 	}
+
+	// everything in view was just used, so only older chunks can go
+	c.terrainChunkLookup.evict(c.maxChunks, c.memoryBudget, len(c.terrainChunksActive))
+}
+
+func abs(n int) int {
+	return max(n, -n)
+}
+
+func (c *Chunker) generateChunk(gen *terrainGen, key chunkKey, resolution int) Model {
+	chunk := buildChunk(gen, key, resolution, c.chunkSize, c.skirtDepth())
+	chunk.Shader = c.shader
+	return chunk
+}
+
+// ask the workers for a chunk, closest to the camera first
+func (c *Chunker) requestChunk(key chunkKey, camPos Float3) {
+	if c.workers == nil {
+		c.workers = newChunkWorkers(c.workerCount)
+	}
+	center := Float2{float64(key.x) * c.chunkSize, float64(key.y) * c.chunkSize}
+	offset := center.sub(Float2{camPos.X, camPos.Z})
+	job := &chunkJob{
+		key:        key,
+		priority:   offset.X*offset.X + offset.Y*offset.Y,
+		gen:        c.generator(),
+		resolution: c.levelResolution(key.level),
+		chunkSize:  c.chunkSize,
+		skirt:      c.skirtDepth(),
+		epoch:      c.epoch,
+	}
+	if c.workers.request(job) {
+		c.terrainChunkLookup.stats.Misses++
+	}
+}
+
+// move finished chunks into the cache
+func (c *Chunker) collectChunks() {
+	if c.workers == nil {
+		return
+	}
+	for _, result := range c.workers.collect() {
+		if result.epoch != c.epoch {
+			continue // made for settings that have changed since
+		}
+		result.model.Shader = c.shader
+		c.terrainChunkLookup.put(result.key, result.model)
+		delete(c.placeholders, result.key.pos())
+	}
+}
+
+// something to draw while a chunk is being made. the same chunk at another
+// level of detail does if there is one, otherwise a rough quick version
+func (c *Chunker) placeholder(key chunkKey) (chunk Model, drawing chunkDrawing) {
+	for level := range c.lodLevels + 1 {
+		if chunk, ok := c.terrainChunkLookup.peek(chunkKey{key.x, key.y, level}); ok {
+			return chunk, chunkDrawing{resolution: c.levelResolution(level)}
+		}
+	}
+	// the same whatever the level, so it can be reused
+	drawing = chunkDrawing{resolution: min(c.resolution, placeholderResolution), rough: true}
+	if chunk, ok := c.placeholders[key.pos()]; ok {
+		return chunk, drawing
+	}
+	if c.placeholders == nil {
+		c.placeholders = make(map[[2]int]Model)
+	}
+	chunk = c.generateChunk(c.roughGenerator(), key, drawing.resolution)
+	c.placeholders[key.pos()] = chunk
+	return chunk, drawing
 }
@@ -0,0 +1,89 @@
+package raster
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ------------ TERRAIN CONFIG -------------
+
+type NoiseAlgorithm int
+
+const (
+	NoiseOpenSimplex NoiseAlgorithm = iota
+	NoisePerlin
+	NoiseCustom // uses TerrainConfig.CustomNoise
+)
+
+// everything that shapes the generated terrain. start from
+// DefaultTerrainConfig and change what you need
+type TerrainConfig struct {
+	Seed        int64
+	Noise       NoiseAlgorithm
+	CustomNoise func(seed int64, x, y float64) float64 // for NoiseCustom, should give roughly -1 to 1
+
+	Layers          int     // how many layers of noise get stacked up
+	Lacunarity      float64 // how fast detail increases per layer
+	Persistence     float64 // how quickly strength of layers decrease
+	RidgeLayerStart int     // layers from here on are ridge like. Layers or more turns ridges off
+	Frequency       float64 // of the first layer, so how big the biggest features are
+
+	HeightScale  float64 // the noise is about -1 to 1 before this
+	HeightOffset float64 // added after scaling
+	WaterLevel   float64 // anything lower gets flattened into water
+	NoWater      bool    // leave the low bits alone instead
+
+	JiggleStrength float64 // how far grid points get nudged so the triangles don't look so regular
+
+	// heights come from this instead of the noise when it's set. the noise
+	// settings above are ignored then, apart from the water and jiggle
+	Heightmap *HeightmapTerrain
+
+	Erosion *ErosionConfig // wears the terrain down, nil for none
+}
+
+func DefaultTerrainConfig() TerrainConfig {
+	return TerrainConfig{
+		Seed:            42,
+		Noise:           NoiseOpenSimplex,
+		Layers:          5,
+		Lacunarity:      2,
+		Persistence:     0.5,
+		RidgeLayerStart: 3,
+		Frequency:       0.05,
+		HeightScale:     10,
+		HeightOffset:    1.8,
+		WaterLevel:      0,
+		JiggleStrength:  0.05,
+	}
+}
+
+func (c TerrainConfig) validate() error {
+	switch {
+	case c.Noise < NoiseOpenSimplex || c.Noise > NoiseCustom:
+		return fmt.Errorf("unknown noise algorithm %v", c.Noise)
+	case c.Noise == NoiseCustom && c.CustomNoise == nil:
+		return errors.New("custom noise needs a CustomNoise function")
+	case c.Layers < 1:
+		return errors.New("terrain needs at least one noise layer")
+	case c.Frequency <= 0 || c.Lacunarity <= 0:
+		return errors.New("terrain frequency and lacunarity have to be positive")
+	}
+	if c.Heightmap != nil {
+		if err := c.Heightmap.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Erosion != nil {
+		return c.Erosion.validate()
+	}
+	return nil
+}
+
+// funcs can't be compared with ==, so CustomNoise is compared by address
+func (c TerrainConfig) equal(other TerrainConfig) bool {
+	sameNoise := reflect.ValueOf(c.CustomNoise).Pointer() == reflect.ValueOf(other.CustomNoise).Pointer()
+	c.CustomNoise, other.CustomNoise = nil, nil
+	return sameNoise && reflect.DeepEqual(c, other)
+}
@@ -0,0 +1,86 @@
+package raster
+
+// ------------ TERRAIN LOD -------------
+
+// far chunks are generated at lower resolutions. neighbours at different
+// resolutions don't share all their border points, so every chunk gets a
+// skirt hanging down from its edges to cover the cracks.
+
+// which chunk, and at what detail. level 0 is full resolution, each level after halves it
+type chunkKey struct {
+	x, y, level int
+}
+
+func (k chunkKey) pos() [2]int {
+	return [2]int{k.x, k.y}
+}
+
+// how deep skirts hang, as a fraction of the chunk size
+const skirtDepthFraction = 0.25
+
+// detail level for a chunk ring chunks away from the camera's chunk
+func (c *Chunker) lodLevel(ring int) int {
+	if c.lodLevels == 0 {
+		return 0
+	}
+	return min(c.lodLevels, max(0, (ring-1)/c.lodStep))
+}
+
+// grid points along a chunk's side at some level, never less than 2
+func (c *Chunker) levelResolution(level int) int {
+	return max(2, (c.resolution-1)>>level+1)
+}
+
+func (c *Chunker) skirtDepth() float64 {
+	if c.lodLevels == 0 {
+		return 0 // everything's the same resolution, so nothing to cover
+	}
+	return c.chunkSize * skirtDepthFraction
+}
+
+// make one chunk. safe to call from the workers, it only reads gen
+func buildChunk(gen *terrainGen, key chunkKey, resolution int, chunkSize, skirt float64) Model {
+	center := Float2{float64(key.x) * chunkSize, float64(key.y) * chunkSize} // chunk center in world sapce
+	chunk := *generateTerrain(gen, resolution, chunkSize, center, skirt, nil)
+	chunk.Transform.UpdateBases()
+	return chunk
+}
+
+// hang a strip down from every border edge of the point map
+func addSkirt(mesh *Mesh, pointMap [][]Float3, depth float64, center Float3) {
+	n := len(pointMap)
+	var border []Float3 // walking around the edge
+	for x := range n {
+		border = append(border, pointMap[0][x])
+	}
+	for y := 1; y < n; y++ {
+		border = append(border, pointMap[y][n-1])
+	}
+	for x := n - 2; x >= 0; x-- {
+		border = append(border, pointMap[n-1][x])
+	}
+	for y := n - 2; y > 0; y-- {
+		border = append(border, pointMap[y][0])
+	}
+
+	down := Float3{0, -depth, 0}
+	for i, a := range border {
+		b := border[(i+1)%len(border)]
+		aLow, bLow := a.add(down), b.add(down)
+
+		// face outwards, so it's seen from the neighbouring chunk's side of the crack
+		normal := triangleNormal(a, b, bLow)
+		if dot3(normal, a.add(b).mulscal(0.5).sub(center)) < 0 {
+			a, b = b, a
+			aLow, bLow = bLow, aLow
+			normal = normal.mulscal(-1)
+		}
+
+		// colored like the ground along the top edge
+		uv := Float2{(a.Y + b.Y) / 2, 0}
+		ia, ib := mesh.appendVertex(a, uv, normal), mesh.appendVertex(b, uv, normal)
+		iaLow, ibLow := mesh.appendVertex(aLow, uv, normal), mesh.appendVertex(bLow, uv, normal)
+		mesh.addTriangle(ia, ib, ibLow)
+		mesh.addTriangle(ia, ibLow, iaLow)
+	}
+}
@@ -0,0 +1,138 @@
+package raster
+
+import "math"
+
+// ------------ TERRAIN QUERIES -------------
+
+// HeightAt and NormalAt rebuild the grid of whichever chunk is drawn at the
+// spot, at the resolution it's drawn at, so they sit exactly on the ground you
+// see even on far away lod chunks and placeholders.
+
+// point maps kept around for queries, cleared when full
+const heightCacheSize = 16
+
+// HeightAt is how high the terrain is at a world position, matching the mesh
+// drawn there in the last frame, lod and all. so things placed on far terrain
+// can end up floating or sunk once it comes closer and gets more detailed.
+// outside the view it goes by full resolution chunks
+func (c *Chunker) HeightAt(x, z float64) float64 {
+	return c.heightAt(x, z, false)
+}
+
+// fullResolution ignores how the chunk is drawn
+func (c *Chunker) heightAt(x, z float64, fullResolution bool) float64 {
+	a, b, cc, weights := c.triangleAt(x, z, fullResolution)
+	return a.Y*weights.X + b.Y*weights.Y + cc.Y*weights.Z + chunkOffset.Y
+}
+
+// NormalAt is the terrain's surface normal at a world position. the terrain is
+// flat shaded, so this is the normal of whichever triangle is there, going by
+// the same mesh as HeightAt
+func (c *Chunker) NormalAt(x, z float64) Float3 {
+	a, b, cc, _ := c.triangleAt(x, z, false)
+	return triangleNormal(a, b, cc)
+}
+
+// how a chunk is drawn, enough to build the same grid again
+type chunkDrawing struct {
+	resolution int
+	rough      bool // a placeholder, made without erosion
+}
+
+type chunkPointsKey struct {
+	pos [2]int
+	chunkDrawing
+}
+
+// the point map of a chunk drawn some way, without chunkOffset
+func (c *Chunker) chunkPoints(pos [2]int, drawing chunkDrawing) [][]Float3 {
+	key := chunkPointsKey{pos, drawing}
+	if points, ok := c.heightCache[key]; ok {
+		return points
+	}
+	if c.heightCache == nil || len(c.heightCache) >= heightCacheSize {
+		c.heightCache = make(map[chunkPointsKey][][]Float3)
+	}
+	gen := c.generator()
+	if drawing.rough {
+		gen = c.roughGenerator()
+	}
+	center := Float2{float64(pos[0]) * c.chunkSize, float64(pos[1]) * c.chunkSize}
+	points := gen.pointMap(drawing.resolution, c.chunkSize, center)
+	c.heightCache[key] = points
+	return points
+}
+
+// how the chunk is drawn, full resolution if it isn't drawn
+func (c *Chunker) drawingAt(pos [2]int) chunkDrawing {
+	if drawing, ok := c.drawn[pos]; ok {
+		return drawing
+	}
+	return chunkDrawing{resolution: c.resolution}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// corners of a grid cell's two triangles, split the same way generateTerrain does.
+// cells are numbered across the whole world at a resolution, chunk edges line up on them
+func (c *Chunker) cellTriangles(n, m int, drawing chunkDrawing) [2][3]Float3 {
+	cells := drawing.resolution - 1
+	chunkX, chunkY := floorDiv(n, cells), floorDiv(m, cells)
+	x, y := n-chunkX*cells, m-chunkY*cells
+	points := c.chunkPoints([2]int{chunkX, chunkY}, drawing)
+	a, b, cc, d := points[y][x], points[y+1][x], points[y][x+1], points[y+1][x+1]
+	return [2][3]Float3{{a, b, cc}, {b, d, cc}}
+}
+
+// barycentric weights of p in the triangle, looking straight down. ok if it's inside
+func groundWeights(a, b, c Float3, p Float2) (weights Float3, ok bool) {
+	a2, b2, c2 := Float2{a.X, a.Z}, Float2{b.X, b.Z}, Float2{c.X, c.Z}
+	area := signedTriangleArea(a2, b2, c2)
+	if area == 0 {
+		return
+	}
+	weights = Float3{signedTriangleArea(b2, c2, p), signedTriangleArea(c2, a2, p), signedTriangleArea(a2, b2, p)}.mulscal(1 / area)
+	const epsilon = -1e-9
+	return weights, weights.X >= epsilon && weights.Y >= epsilon && weights.Z >= epsilon
+}
+
+// the triangle under a world position, in chunk space, and where in it the position is
+func (c *Chunker) triangleAt(x, z float64, fullResolution bool) (a, b, cc Float3, weights Float3) {
+	if c.chunkSize <= 0 || c.resolution < 2 {
+		return
+	}
+	p := Float2{x - chunkOffset.X, z - chunkOffset.Z}
+	chunk := [2]int{int(math.Floor(p.X/c.chunkSize + 0.5)), int(math.Floor(p.Y/c.chunkSize + 0.5))}
+	drawing := c.drawingAt(chunk)
+	if fullResolution {
+		drawing = chunkDrawing{resolution: c.resolution}
+	}
+	cellSize := c.chunkSize / float64(drawing.resolution-1)
+	n := int(math.Floor((p.X + c.chunkSize/2) / cellSize))
+	m := int(math.Floor((p.Y + c.chunkSize/2) / cellSize))
+
+	// jiggle can push the point into a neighbouring cell, so look around
+	bestMiss := math.Inf(1)
+	for _, offset := range [9][2]int{{0, 0}, {-1, 0}, {1, 0}, {0, -1}, {0, 1}, {-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+		for _, tri := range c.cellTriangles(n+offset[0], m+offset[1], drawing) {
+			w, inside := groundWeights(tri[0], tri[1], tri[2], p)
+			if inside {
+				return tri[0], tri[1], tri[2], w
+			}
+			// keep the closest in case floating point lets it slip between triangles
+			if miss := -min(w.X, w.Y, w.Z); miss < bestMiss {
+				bestMiss = miss
+				a, b, cc = tri[0], tri[1], tri[2]
+				weights = Float3{max(w.X, 0), max(w.Y, 0), max(w.Z, 0)}
+				weights = weights.mulscal(1 / (weights.X + weights.Y + weights.Z))
+			}
+		}
+	}
+	return
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/wosly2/go3Dsw/font"
 )
 
+const showTerrain = false
+
 type Process struct { // implements raster.UpdateProcess
 	font font.Font
 }
@@ -17,6 +19,12 @@ func (p Process) Update(swr *raster.SoftwareRasterizer, sc *raster.Scene) {
 	// gui
 	var helloWorld *sdl.Surface = p.font.RenderString(fmt.Sprintf("fps: %v", math.Round(raster.FPS())), 1, 0, 1)
 	helloWorld.BlitScaled(nil, swr.Buffer, &sdl.Rect{X: 5, Y: 5, W: helloWorld.W * 3, H: helloWorld.H * 3})
+
+	// don't fly through mountains
+	if sc.Chunker != nil {
+		pos := &sc.Cam.Transform.Position
+		pos.Y = max(pos.Y, sc.Chunker.HeightAt(pos.X, pos.Z)+1.5)
+	}
 }
 
 func main() {
@@ -44,26 +52,36 @@ func main() {
 	//mainScene.bgCol = Float3{0.396, 0.773, 1}
 	mainScene.BGcol = raster.Float3{X: 1, Y: 1, Z: 1}
 
-	// // chunker
-	// mainScene.cam.transform.position.y = 5
-	// mainScene.chunker = &Chunker{shader: TerrainShader{
-	// 	Float3{0, 1, 0},
-	// 	defaultColors,
-	// 	defaultHeights,
-	// 	mainScene.bgCol,
-	// }, resolution: 30, chunkSize: 20}
+	// chunker
+	if showTerrain {
+		mainScene.Cam.Transform.Position.Y = 5
+		chunker, err := raster.NewChunker(raster.ChunkerOptions{
+			ViewRadius: 2,
+			ChunkSize:  20,
+			Resolution: 30,
+			Shader: raster.TerrainShader{
+				DirectionToLight: raster.Float3{X: 0, Y: 1, Z: 0},
+				Colors:           raster.GetDefaultTerrainShaderColors(),
+				Heights:          raster.GetDefaultTerrainShaderHeights(),
+				BGcol:            mainScene.BGcol,
+			},
+		})
+		raster.Check(err)
+		mainScene.Chunker = chunker
+	}
 
-	mainScene.AddModel(raster.NewModel(raster.ModelInitOptions{
+	suzy := raster.NewModel(raster.ModelInitOptions{
 		ID:           "suzy",
 		LoadFromPath: true,
 		Path:         "../assets/suzy.obj",
 		GiveColors:   false,
-	}))
-	mainScene.GetModel("suzy").Transform.Position = raster.Float3{X: 0, Y: 0, Z: 8}
-	mainScene.GetModel("suzy").Transform.Pitch = raster.ToRadians(-90)
-	mainScene.GetModel("suzy").Transform.Scale = raster.Float3{X: 2, Y: 2, Z: 2}
-	mainScene.GetModel("suzy").Transform.UpdateBases()
-	mainScene.GetModel("suzy").Shader = raster.LitShader{
+	})
+	raster.Check(mainScene.AddModel(suzy))
+	suzy.Transform.Position = raster.Float3{X: 0, Y: 0, Z: 8}
+	suzy.Transform.Pitch = raster.ToRadians(-90)
+	suzy.Transform.Scale = raster.Float3{X: 2, Y: 2, Z: 2}
+	suzy.Transform.UpdateBases()
+	suzy.Shader = raster.LitShader{
 		Color:            raster.Float3{X: 0.396, Y: 0.773, Z: 1},
 		DirectionToLight: raster.Float3{X: 0, Y: -0.5, Z: -1},
 	}
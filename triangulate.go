@@ -0,0 +1,137 @@
+package raster
+
+import "math"
+
+// ------------ TRIANGULATION -------------
+
+// z of the cross product of ab and ac, positive if abc turns counter clockwise
+func cross2(a, b, c Float2) float64 {
+	ab, ac := b.sub(a), c.sub(a)
+	return ab.X*ac.Y - ab.Y*ac.X
+}
+
+// do segments ab and cd properly cross each other
+func segmentsIntersect(a, b, c, d Float2) bool {
+	d1, d2 := cross2(c, d, a), cross2(c, d, b)
+	d3, d4 := cross2(a, b, c), cross2(a, b, d)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// flatten the polygon onto its own plane. ok is false if it has no area
+func projectPolygon(points []Float3) (projected []Float2, ok bool) {
+	normal := polygonNormal(points)
+	if normal == (Float3{}) {
+		return nil, false
+	}
+
+	// any axis not parallel to the normal will do for building the plane basis
+	axis := Float3{1, 0, 0}
+	if math.Abs(normal.X) > 0.9 {
+		axis = Float3{0, 1, 0}
+	}
+	u := cross3(axis, normal).normalized()
+	v := cross3(normal, u)
+
+	projected = make([]Float2, len(points))
+	for i, p := range points {
+		projected[i] = Float2{dot3(p, u), dot3(p, v)}
+	}
+	return projected, true
+}
+
+func fanTriangles(n int) (triangles [][3]int) {
+	for i := 1; i < n-1; i++ {
+		triangles = append(triangles, [3]int{0, i, i + 1})
+	}
+	return
+}
+
+// split the face into triangles (as indices into its corners) by ear clipping
+// on the face plane. concave faces are fine. if the face is degenerate or
+// crosses itself it falls back to a triangle fan and ok is false.
+func (f Face) triangulate() (triangles [][3]int, ok bool) {
+	n := len(f.vertices)
+	if n == 3 {
+		return [][3]int{{0, 1, 2}}, true
+	}
+
+	points, ok := projectPolygon(f.vertices)
+	if !ok {
+		return fanTriangles(n), false
+	}
+
+	// edges that aren't neighbours shouldn't touch
+	for i := range n {
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n-1 {
+				continue
+			}
+			if segmentsIntersect(points[i], points[(i+1)%n], points[j], points[(j+1)%n]) {
+				return fanTriangles(n), false
+			}
+		}
+	}
+
+	remaining := make([]int, n)
+	for i := range remaining {
+		remaining[i] = i
+	}
+
+	// what counts as no area depends on how big the face is
+	low, high := points[0], points[0]
+	for _, p := range points {
+		low = Float2{min(low.X, p.X), min(low.Y, p.Y)}
+		high = Float2{max(high.X, p.X), max(high.Y, p.Y)}
+	}
+	extent := max(high.X-low.X, high.Y-low.Y)
+	epsilon := 1e-12 * extent * extent
+	for len(remaining) > 3 {
+		m := len(remaining)
+		clipped := false
+
+		for i := range m {
+			prev, cur, next := remaining[(i+m-1)%m], remaining[i], remaining[(i+1)%m]
+			a, b, c := points[prev], points[cur], points[next]
+
+			area := cross2(a, b, c)
+			if area < -epsilon { // reflex corner, can't be an ear
+				continue
+			}
+
+			// no other corner may sit inside the ear
+			blocked := false
+			if area > epsilon {
+				for _, other := range remaining {
+					if other == prev || other == cur || other == next {
+						continue
+					}
+					p := points[other]
+					if cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0 {
+						blocked = true
+						break
+					}
+				}
+			}
+			if blocked {
+				continue
+			}
+
+			// collinear corners just get dropped
+			if area > epsilon {
+				triangles = append(triangles, [3]int{prev, cur, next})
+			}
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			clipped = true
+			break
+		}
+
+		if !clipped {
+			return fanTriangles(n), false
+		}
+	}
+
+	if cross2(points[remaining[0]], points[remaining[1]], points[remaining[2]]) > epsilon {
+		triangles = append(triangles, [3]int{remaining[0], remaining[1], remaining[2]})
+	}
+	return triangles, true
+}
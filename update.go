@@ -18,6 +18,7 @@ type SoftwareRasterizer struct {
 
 	Buffer     *sdl.Surface // the buffer that is drawn to the screen.
 	MetaBuffer Image        // meta buffer is rendered to by the rasterizer. it is then rendered to SoftwareRasterizer.Buffer.
+	IDBuffer   bool         // keep track of what's in each pixel, see Pick
 
 	Process UpdateProcess
 }
@@ -111,7 +112,7 @@ func (s *SoftwareRasterizer) Update(scene *Scene) {
 
 		s.initiated = true
 
-		scene.Cam.transform.UpdateBases()
+		scene.Cam.Transform.UpdateBases()
 	}
 
 	// ---------------------- fps
@@ -139,53 +140,52 @@ func (s *SoftwareRasterizer) Update(scene *Scene) {
 	keys := sdl.GetKeyboardState()
 	// rot
 	if keys[sdl.SCANCODE_UP] != 0 {
-		scene.Cam.transform.Pitch += rotSpeed
-		scene.Cam.transform.Pitch = clamp(scene.Cam.transform.Pitch, ToRadians(-85), ToRadians(85))
-		scene.Cam.transform.UpdateBases()
+		scene.Cam.Transform.Pitch += rotSpeed
+		scene.Cam.Transform.Pitch = clamp(scene.Cam.Transform.Pitch, ToRadians(-85), ToRadians(85))
+		scene.Cam.Transform.UpdateBases()
 	}
 	if keys[sdl.SCANCODE_DOWN] != 0 {
-		scene.Cam.transform.Pitch -= rotSpeed
-		scene.Cam.transform.Pitch = clamp(scene.Cam.transform.Pitch, ToRadians(-85), ToRadians(85))
-		scene.Cam.transform.UpdateBases()
+		scene.Cam.Transform.Pitch -= rotSpeed
+		scene.Cam.Transform.Pitch = clamp(scene.Cam.Transform.Pitch, ToRadians(-85), ToRadians(85))
+		scene.Cam.Transform.UpdateBases()
 	}
 	if keys[sdl.SCANCODE_LEFT] != 0 {
-		scene.Cam.transform.Yaw += rotSpeed
-		scene.Cam.transform.UpdateBases()
+		scene.Cam.Transform.Yaw += rotSpeed
+		scene.Cam.Transform.UpdateBases()
 	}
 	if keys[sdl.SCANCODE_RIGHT] != 0 {
-		scene.Cam.transform.Yaw -= rotSpeed
-		scene.Cam.transform.UpdateBases()
+		scene.Cam.Transform.Yaw -= rotSpeed
+		scene.Cam.Transform.UpdateBases()
 	}
 	// pos
 	// get bases
-	ihat, _, khat := scene.Cam.transform.GetBasisVectors()
+	ihat, _, khat := scene.Cam.Transform.GetBasisVectors()
 	if keys[sdl.SCANCODE_W] != 0 {
-		scene.Cam.transform.Position = scene.Cam.transform.Position.add(khat.mulscal(moveSpeed))
+		scene.Cam.Transform.Position = scene.Cam.Transform.Position.add(khat.mulscal(moveSpeed))
 	}
 	if keys[sdl.SCANCODE_S] != 0 {
-		scene.Cam.transform.Position = scene.Cam.transform.Position.sub(khat.mulscal(moveSpeed))
+		scene.Cam.Transform.Position = scene.Cam.Transform.Position.sub(khat.mulscal(moveSpeed))
 	}
 	if keys[sdl.SCANCODE_Q] != 0 {
-		scene.Cam.transform.Position.Y -= moveSpeed
+		scene.Cam.Transform.Position.Y -= moveSpeed
 	}
 	if keys[sdl.SCANCODE_E] != 0 {
-		scene.Cam.transform.Position.Y += moveSpeed
+		scene.Cam.Transform.Position.Y += moveSpeed
 	}
 	if keys[sdl.SCANCODE_A] != 0 {
-		scene.Cam.transform.Position = scene.Cam.transform.Position.sub(ihat.mulscal(moveSpeed))
+		scene.Cam.Transform.Position = scene.Cam.Transform.Position.sub(ihat.mulscal(moveSpeed))
 	}
 	if keys[sdl.SCANCODE_D] != 0 {
-		scene.Cam.transform.Position = scene.Cam.transform.Position.add(ihat.mulscal(moveSpeed))
+		scene.Cam.Transform.Position = scene.Cam.Transform.Position.add(ihat.mulscal(moveSpeed))
 	}
 
 	// --------------------- drawing
 
-	// clear
-	s.MetaBuffer.fillcb(scene.BGcol)
-	s.MetaBuffer.filldb()
-
 	// -------------- draw
-	s.MetaBuffer = renderScene(Scene(*scene), s.MetaBuffer)
+	if s.IDBuffer && !s.MetaBuffer.HasIDBuffer() {
+		s.MetaBuffer.EnableIDBuffer()
+	}
+	s.MetaBuffer = renderFrame(Scene(*scene), s.MetaBuffer)
 
 	// get the pixels on the buffer
 	pixels := getPixels(s.Buffer)
@@ -0,0 +1,115 @@
+package raster
+
+import "math"
+
+// ------------ VIEWPORTS -------------
+
+// part of an image, as fractions of its size from the bottom left. the zero
+// value covers the whole thing.
+type Rect struct {
+	X, Y, W, H float64
+}
+
+// the pixels a rect covers in a w by h image, x0/y0 inclusive and x1/y1 exclusive
+func (r Rect) pixels(w, h int) (x0, y0, x1, y1 int) {
+	if r == (Rect{}) {
+		return 0, 0, w, h
+	}
+	toPixel := func(f float64, size int) int {
+		return int(clamp(math.Round(f*float64(size)), 0, float64(size)))
+	}
+	return toPixel(r.X, w), toPixel(r.Y, h), toPixel(r.X+r.W, w), toPixel(r.Y+r.H, h)
+}
+
+// one camera's view of the scene. split screen is a couple of these side by
+// side, a minimap is a small one on top with NoClear.
+type Viewport struct {
+	Cam     *Camera // nil uses Scene.Cam
+	Rect    Rect    // where on the target it goes
+	Target  *Image  // draw here instead of the window, e.g. to use as a texture. see NewImage
+	BGcol   *Float3 // nil uses Scene.BGcol
+	NoClear bool    // draw over whatever is already there instead of filling with BGcol first
+}
+
+// NewImage makes a blank w by h image, handy as a Viewport target
+func NewImage(w, h int) Image {
+	img := newImage(w, h)
+	img.filldb()
+	return img
+}
+
+func (i Image) Width() int {
+	return i.w
+}
+
+func (i Image) Height() int {
+	return i.h
+}
+
+// a view onto part of the image. it shares pixels with the original, so
+// drawing into it draws into the original.
+func (i Image) sub(r Rect) Image {
+	x0, y0, x1, y1 := r.pixels(i.w, i.h)
+	sub := Image{
+		colorBuffer: make([][]Float3, y1-y0),
+		depthBuffer: make([][]float64, y1-y0),
+		w:           x1 - x0,
+		h:           y1 - y0,
+	}
+	if i.idBuffer != nil {
+		sub.idBuffer = make([][]Pick, sub.h)
+	}
+	for y := range sub.h {
+		sub.colorBuffer[y] = i.colorBuffer[y0+y][x0:x1]
+		sub.depthBuffer[y] = i.depthBuffer[y0+y][x0:x1]
+		if i.idBuffer != nil {
+			sub.idBuffer[y] = i.idBuffer[y0+y][x0:x1]
+		}
+	}
+	return sub
+}
+
+func (s Scene) viewports() []Viewport {
+	if len(s.Viewports) == 0 {
+		return []Viewport{{}} // just the main camera, full screen
+	}
+	return s.Viewports
+}
+
+// draw every viewport of the scene. window viewports are drawn in order, so later ones land on top
+func renderFrame(s Scene, target Image) Image {
+	stats = RenderStats{}
+	defer func() { lastStats = stats }()
+
+	// terrain follows the main camera, whichever views are looking at it
+	if s.Chunker != nil {
+		s.Chunker.updateTerrainChunks(s.Cam.Position())
+	}
+
+	for _, vp := range s.passOrder() {
+		cam := s.Cam
+		if vp.Cam != nil {
+			cam = *vp.Cam
+		}
+		img := target
+		if vp.Target != nil {
+			img = *vp.Target
+		}
+		img = img.sub(vp.Rect)
+		if img.w == 0 || img.h == 0 {
+			continue
+		}
+
+		if !vp.NoClear {
+			bg := s.BGcol
+			if vp.BGcol != nil {
+				bg = *vp.BGcol
+			}
+			img.fillcb(bg)
+			img.clearIDs()
+		}
+		img.filldb()
+		renderScene(s, cam, img, vp.Target)
+	}
+	return target
+}